@@ -0,0 +1,297 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/enolgor/wimod-lorawan-endnode-controller/wimod"
+)
+
+const configUsageMessage = `
+Usage: loractl config <subcommand> [<args>]
+
+Available subcommands:
+  radio       Read or modify the radio stack configuration, only the flags
+              given are changed
+  custom      Read or modify the custom configuration (RF gain)
+  linkadr     Read or modify how LinkADRReq MAC commands are handled
+`
+
+var configRadioCommand = flag.NewFlagSet("config radio", flag.ExitOnError)
+var configCustomCommand = flag.NewFlagSet("config custom", flag.ExitOnError)
+var configLinkADRCommand = flag.NewFlagSet("config linkadr", flag.ExitOnError)
+
+var radioDataRate uint
+
+const (
+	radioDataRateFlag        = "datarate"
+	defaultRadioDataRateFlag = 0
+	radioDataRateUsage       = "Set default data rate index"
+)
+
+var radioTXPower uint
+
+const (
+	radioTXPowerFlag        = "txpower"
+	defaultRadioTXPowerFlag = 0
+	radioTXPowerUsage       = "Set default TX power level (EIRP) in dBm"
+)
+
+var radioADR bool
+
+const (
+	radioADRFlag        = "adr"
+	defaultRadioADRFlag = false
+	radioADRUsage       = "Enable or disable adaptative data rate"
+)
+
+var radioDutyCycle bool
+
+const (
+	radioDutyCycleFlag        = "dutycycle"
+	defaultRadioDutyCycleFlag = false
+	radioDutyCycleUsage       = "Enable or disable duty cycle control (customer mode required)"
+)
+
+var radioClassC bool
+
+const (
+	radioClassCFlag        = "classc"
+	defaultRadioClassCFlag = false
+	radioClassCUsage       = "Select class C (true) or class A (false)"
+)
+
+var radioMACEvents bool
+
+const (
+	radioMACEventsFlag        = "macevents"
+	defaultRadioMACEventsFlag = false
+	radioMACEventsUsage       = "Enable or disable forwarding of received MAC commands"
+)
+
+var radioExtendedHCI bool
+
+const (
+	radioExtendedHCIFlag        = "extendedhci"
+	defaultRadioExtendedHCIFlag = false
+	radioExtendedHCIUsage       = "Enable or disable extended RF packet output format"
+)
+
+var radioPowerSaving bool
+
+const (
+	radioPowerSavingFlag        = "powersaving"
+	defaultRadioPowerSavingFlag = false
+	radioPowerSavingUsage       = "Enable or disable automatic power saving"
+)
+
+var radioRetransmissions uint
+
+const (
+	radioRetransmissionsFlag        = "retransmissions"
+	defaultRadioRetransmissionsFlag = 0
+	radioRetransmissionsUsage       = "Set maximum number of retransmissions for confirmed data: 0-254"
+)
+
+var radioBand uint
+
+const (
+	radioBandFlag        = "band"
+	defaultRadioBandFlag = 0
+	radioBandUsage       = "Set band index (the device is deactivated if the band changes)"
+)
+
+var radioMACCmdCapacity uint
+
+const (
+	radioMACCmdCapacityFlag        = "maccmdcapacity"
+	defaultRadioMACCmdCapacityFlag = 0
+	radioMACCmdCapacityUsage       = "Set header MAC command capacity: 0-15"
+)
+
+var customRFGain int
+
+const (
+	customRFGainFlag        = "rfgain"
+	defaultCustomRFGainFlag = 0
+	customRFGainUsage       = "Set RF gain offset in dBd: -128 to 127 (customer mode required)"
+)
+
+var linkADROption string
+
+const (
+	linkADROptionFlag        = "option"
+	defaultLinkADROptionFlag = ""
+	linkADROptionUsage       = "Set LinkADRReq handling option: v1.0.2|semtech|kpn"
+)
+
+func init() {
+	configRadioCommand.StringVar(&serverHost, serverHostFlag, defaultServerHostFlag, serverHostUsage)
+	configRadioCommand.UintVar(&radioDataRate, radioDataRateFlag, defaultRadioDataRateFlag, radioDataRateUsage)
+	configRadioCommand.UintVar(&radioTXPower, radioTXPowerFlag, defaultRadioTXPowerFlag, radioTXPowerUsage)
+	configRadioCommand.BoolVar(&radioADR, radioADRFlag, defaultRadioADRFlag, radioADRUsage)
+	configRadioCommand.BoolVar(&radioDutyCycle, radioDutyCycleFlag, defaultRadioDutyCycleFlag, radioDutyCycleUsage)
+	configRadioCommand.BoolVar(&radioClassC, radioClassCFlag, defaultRadioClassCFlag, radioClassCUsage)
+	configRadioCommand.BoolVar(&radioMACEvents, radioMACEventsFlag, defaultRadioMACEventsFlag, radioMACEventsUsage)
+	configRadioCommand.BoolVar(&radioExtendedHCI, radioExtendedHCIFlag, defaultRadioExtendedHCIFlag, radioExtendedHCIUsage)
+	configRadioCommand.BoolVar(&radioPowerSaving, radioPowerSavingFlag, defaultRadioPowerSavingFlag, radioPowerSavingUsage)
+	configRadioCommand.UintVar(&radioRetransmissions, radioRetransmissionsFlag, defaultRadioRetransmissionsFlag, radioRetransmissionsUsage)
+	configRadioCommand.UintVar(&radioBand, radioBandFlag, defaultRadioBandFlag, radioBandUsage)
+	configRadioCommand.UintVar(&radioMACCmdCapacity, radioMACCmdCapacityFlag, defaultRadioMACCmdCapacityFlag, radioMACCmdCapacityUsage)
+
+	configCustomCommand.StringVar(&serverHost, serverHostFlag, defaultServerHostFlag, serverHostUsage)
+	configCustomCommand.IntVar(&customRFGain, customRFGainFlag, defaultCustomRFGainFlag, customRFGainUsage)
+
+	configLinkADRCommand.StringVar(&serverHost, serverHostFlag, defaultServerHostFlag, serverHostUsage)
+	configLinkADRCommand.StringVar(&linkADROption, linkADROptionFlag, defaultLinkADROptionFlag, linkADROptionUsage)
+}
+
+func runConfigCommand(args []string) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, configUsageMessage)
+		os.Exit(1)
+	}
+	switch args[0] {
+	case "radio":
+		configRadioCommand.Parse(args[1:])
+		runConfigRadioCommand()
+	case "custom":
+		configCustomCommand.Parse(args[1:])
+		runConfigCustomCommand()
+	case "linkadr":
+		configLinkADRCommand.Parse(args[1:])
+		runConfigLinkADRCommand()
+	default:
+		fmt.Fprintf(os.Stderr, "%q is not a valid config subcommand\n", args[0])
+		fmt.Fprint(os.Stderr, configUsageMessage)
+		os.Exit(1)
+	}
+}
+
+func checkRange(name string, value, max uint) {
+	if value > max {
+		printErrorAndExit(fmt.Errorf("%s should be from 0 to %d", name, max))
+	}
+}
+
+func runConfigRadioCommand() {
+	checkRange(radioDataRateFlag, radioDataRate, 255)
+	checkRange(radioTXPowerFlag, radioTXPower, 255)
+	checkRange(radioRetransmissionsFlag, radioRetransmissions, 254)
+	checkRange(radioBandFlag, radioBand, 255)
+	checkRange(radioMACCmdCapacityFlag, radioMACCmdCapacity, 15)
+	client := getClient()
+	resp, err := client.GetRStackConfig()
+	if err != nil {
+		printErrorAndExit(err)
+	}
+	config := resp.RStackConfig
+	changed := false
+	configRadioCommand.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case radioDataRateFlag:
+			config.DefaultDataRateIdx = byte(radioDataRate)
+		case radioTXPowerFlag:
+			config.TXPowerLevel = byte(radioTXPower)
+		case radioADRFlag:
+			config.AdaptativeDataRate = radioADR
+		case radioDutyCycleFlag:
+			config.DutyCycleControl = radioDutyCycle
+		case radioClassCFlag:
+			config.ClassC = radioClassC
+		case radioMACEventsFlag:
+			config.MACEvents = radioMACEvents
+		case radioExtendedHCIFlag:
+			config.ExtendedHCI = radioExtendedHCI
+		case radioPowerSavingFlag:
+			config.AutomaticPowerSaving = radioPowerSaving
+		case radioRetransmissionsFlag:
+			config.MaxRetransmissions = byte(radioRetransmissions)
+		case radioBandFlag:
+			config.BandIdx = byte(radioBand)
+		case radioMACCmdCapacityFlag:
+			config.HeaderMACCmdCapacity = byte(radioMACCmdCapacity)
+		default:
+			return
+		}
+		changed = true
+	})
+	if changed {
+		err = client.SetRStackConfig(config)
+		if err != nil {
+			printErrorAndExit(err)
+		}
+		resp, err = client.GetRStackConfig()
+		if err != nil {
+			printErrorAndExit(err)
+		}
+	}
+	w := getTabWriter()
+	printRadioInfo(w, &resp.RStackConfig)
+	w.Flush()
+}
+
+func runConfigCustomCommand() {
+	if customRFGain < -128 || customRFGain > 127 {
+		printErrorAndExit(fmt.Errorf("%s should be from -128 to 127", customRFGainFlag))
+	}
+	client := getClient()
+	configCustomCommand.Visit(func(f *flag.Flag) {
+		if f.Name != customRFGainFlag {
+			return
+		}
+		err := client.SetCustomCfg(int8(customRFGain))
+		if err != nil {
+			printErrorAndExit(err)
+		}
+	})
+	resp, err := client.GetCustomCfg()
+	if err != nil {
+		printErrorAndExit(err)
+	}
+	w := getTabWriter()
+	fmt.Fprint(w, "\nCUSTOM CONFIG:\n\n")
+	fmt.Fprintf(w, "RF Gain:\t%d dBd\n", resp.RFGain)
+	w.Flush()
+}
+
+var linkADROptions = map[string]byte{
+	"v1.0.2":  wimod.LORAWAN_LINKADRREQ_OPTION_V1_0_2,
+	"semtech": wimod.LORAWAN_LINKADRREQ_OPTION_SEMTECH,
+	"kpn":     wimod.LORAWAN_LINKADRREQ_OPTION_KPN_ACTILITY,
+}
+
+func linkADROptionString(option byte) string {
+	switch option {
+	case wimod.LORAWAN_LINKADRREQ_OPTION_V1_0_2:
+		return "LoRaWAN v1.0.2 (reject all)"
+	case wimod.LORAWAN_LINKADRREQ_OPTION_SEMTECH:
+		return "Semtech proposal (accept channel mask when data rate and TX power are 0xF)"
+	case wimod.LORAWAN_LINKADRREQ_OPTION_KPN_ACTILITY:
+		return "KPN/Actility proposal (apply channel mask and redundancy only)"
+	}
+	return "Unknown"
+}
+
+func runConfigLinkADRCommand() {
+	client := getClient()
+	if linkADROption != "" {
+		option, ok := linkADROptions[linkADROption]
+		if !ok {
+			printErrorAndExit(fmt.Errorf("%s should be v1.0.2, semtech or kpn", linkADROptionFlag))
+		}
+		err := client.SetLinkADRReqConfig(option)
+		if err != nil {
+			printErrorAndExit(err)
+		}
+	}
+	resp, err := client.GetLinkADRReqConfig()
+	if err != nil {
+		printErrorAndExit(err)
+	}
+	w := getTabWriter()
+	fmt.Fprint(w, "\nLINKADRREQ CONFIG:\n\n")
+	fmt.Fprintf(w, "Option:\t%d - %s\n", resp.Option, linkADROptionString(resp.Option))
+	w.Flush()
+}
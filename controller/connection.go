@@ -0,0 +1,222 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/enolgor/wimod-lorawan-endnode-controller/slip"
+)
+
+type ConnectionState byte
+
+const (
+	ConnectionDisconnected ConnectionState = iota
+	ConnectionConnected
+	ConnectionReconnecting
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case ConnectionDisconnected:
+		return "disconnected"
+	case ConnectionConnected:
+		return "connected"
+	case ConnectionReconnecting:
+		return "reconnecting"
+	}
+	return "unknown"
+}
+
+// ConnectionEvent reports a change of the connection state. Err is the error
+// that broke the connection or made the last reconnection attempt fail, and
+// Attempt the number of the upcoming reconnection attempt.
+type ConnectionEvent struct {
+	State   ConnectionState
+	Attempt int
+	Err     error
+	Time    time.Time
+}
+
+func (e ConnectionEvent) String() string {
+	if e.Err != nil {
+		return fmt.Sprintf("ConnectionEvent[State: %s, Attempt: %d, Err: %s]", e.State, e.Attempt, e.Err)
+	}
+	return fmt.Sprintf("ConnectionEvent[State: %s, Attempt: %d]", e.State, e.Attempt)
+}
+
+const (
+	DefaultReconnectBackoff    = 500 * time.Millisecond
+	DefaultMaxReconnectBackoff = 30 * time.Second
+)
+
+var ErrDisconnected = errors.New("modem disconnected")
+
+// DisconnectedError is returned to the requests that could not be sent or
+// answered because the connection to the modem was lost.
+type DisconnectedError struct {
+	Err error
+}
+
+func (e *DisconnectedError) Error() string {
+	if e.Err == nil {
+		return ErrDisconnected.Error()
+	}
+	return fmt.Sprintf("%s: %s", ErrDisconnected, e.Err)
+}
+
+func (e *DisconnectedError) Unwrap() error {
+	return e.Err
+}
+
+func (e *DisconnectedError) Is(target error) bool {
+	return target == ErrDisconnected
+}
+
+func (c *WiModController) ConnectionState() ConnectionState {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.state
+}
+
+// WatchConnection returns the connection state changes from now on until the
+// returned function is called or the controller is closed. Changes are
+// dropped if the channel is full.
+func (c *WiModController) WatchConnection() (<-chan ConnectionEvent, func()) {
+	channel := make(chan ConnectionEvent, 10)
+	c.mutex.Lock()
+	if c.closed {
+		close(channel)
+	} else {
+		c.connWatchers = append(c.connWatchers, channel)
+	}
+	c.mutex.Unlock()
+	return channel, func() {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		for i, ch := range c.connWatchers {
+			if ch == channel {
+				c.connWatchers = append(c.connWatchers[:i:i], c.connWatchers[i+1:]...)
+				close(channel)
+				return
+			}
+		}
+	}
+}
+
+// setState must be called with the mutex held.
+func (c *WiModController) setState(state ConnectionState, attempt int, err error) {
+	c.state = state
+	event := ConnectionEvent{State: state, Attempt: attempt, Err: err, Time: time.Now()}
+	for _, channel := range c.connWatchers {
+		select {
+		case channel <- event:
+		default:
+		}
+	}
+}
+
+// connect returns false if the controller was closed meanwhile.
+func (c *WiModController) connect(stream io.ReadWriteCloser) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		stream.Close()
+		return false
+	}
+	c.rwc = stream
+	c.lost = make(chan bool)
+	c.frames = c.readFrames(slip.NewDecoder(countingReader{stream, &c.stats.bytesIn}), c.lost)
+	c.connErr = nil
+	c.powerSaving = powerSavingUnknown
+	c.lastActivity = time.Time{}
+	c.setState(ConnectionConnected, 0, nil)
+	c.logger.Info("connected")
+	return true
+}
+
+type frame struct {
+	payload []byte
+	err     error
+}
+
+// readFrames reads the frames of a connection from their own goroutine, so
+// that the controller does not wait on a pending read that closing the stream
+// may not interrupt, as it happens with some serial ports. The goroutine exits
+// after the first error other than a framing one, or once the connection is
+// lost or the controller closed.
+func (c *WiModController) readFrames(decoder *slip.SlipDecoder, lost <-chan bool) <-chan frame {
+	frames := make(chan frame)
+	go func() {
+		for {
+			payload, err := decoder.ReadFrame()
+			select {
+			case frames <- frame{payload, err}:
+			case <-lost:
+				return
+			case <-c.closing:
+				return
+			}
+			if err != nil && !errors.As(err, new(*slip.FramingError)) {
+				return
+			}
+		}
+	}()
+	return frames
+}
+
+func (c *WiModController) disconnect(err error) {
+	c.mutex.Lock()
+	rwc := c.rwc
+	c.rwc = nil
+	c.connErr = err
+	close(c.lost)
+	c.setState(ConnectionDisconnected, 0, err)
+	c.mutex.Unlock()
+	c.logger.Warn("connection lost", slog.Any("error", err))
+	rwc.Close()
+}
+
+// reconnect dials until it succeeds, backing off exponentially between
+// attempts, and returns false if the controller is closed first.
+func (c *WiModController) reconnect() bool {
+	backoff := c.reconnectBackoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		c.mutex.Lock()
+		c.setState(ConnectionReconnecting, attempt, err)
+		c.mutex.Unlock()
+		c.logger.Info("reconnecting", slog.Int("attempt", attempt), slog.Duration("backoff", backoff), slog.Any("error", err))
+		select {
+		case <-c.closing:
+			return false
+		case <-time.After(backoff):
+		}
+		var stream io.ReadWriteCloser
+		stream, err = c.dial()
+		if err == nil {
+			c.stats.reconnections.Add(1)
+			return c.connect(stream)
+		}
+		backoff *= 2
+		if backoff > c.maxReconnectBackoff {
+			backoff = c.maxReconnectBackoff
+		}
+	}
+}
+
+// connection returns the current stream, nil if disconnected, and a channel
+// closed once it is lost.
+func (c *WiModController) connection() (io.ReadWriteCloser, chan bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.rwc, c.lost
+}
+
+func (c *WiModController) disconnectedError() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return &DisconnectedError{Err: c.connErr}
+}
@@ -1,9 +1,13 @@
 package controller
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"sync"
+	"time"
 
 	"github.com/enolgor/wimod-lorawan-endnode-controller/hci"
 	"github.com/enolgor/wimod-lorawan-endnode-controller/slip"
@@ -11,24 +15,87 @@ import (
 )
 
 type WiModController struct {
-	rwc           io.ReadWriteCloser
-	slipDecoder   *slip.SlipDecoder
-	closer        chan bool
-	events        chan hci.HCIPacket
-	respChannels  map[uint16][]chan hci.HCIPacket
-	eventChannels map[uint16][]chan hci.HCIPacket
-	noBlock       bool
-	mutex         *sync.Mutex
+	rwc                 io.ReadWriteCloser
+	frames              <-chan frame
+	stats               controllerStats
+	closing             chan struct{}
+	done                chan struct{}
+	closeOnce           sync.Once
+	err                 error
+	events              chan hci.HCIPacket
+	respChannels        map[uint16][]chan hci.HCIPacket
+	eventChannels       map[uint16][]chan hci.HCIPacket
+	rxOutcomeChannels   []chan RxOutcome
+	rxOutcomeWatchers   []chan RxOutcome
+	subscriptions       []*Subscription
+	indWatchers         []indicationWatcher
+	queue               *requestQueue
+	pendingUplink       uint16
+	noBlock             bool
+	requestTimeout      time.Duration
+	indTimeout          time.Duration
+	dial                func() (io.ReadWriteCloser, error)
+	reconnectBackoff    time.Duration
+	maxReconnectBackoff time.Duration
+	state               ConnectionState
+	connErr             error
+	lost                chan bool
+	connWatchers        []chan ConnectionEvent
+	closed              bool
+	logger              *slog.Logger
+	wakeUpLength        int
+	wakeUpIdleThreshold time.Duration
+	powerSaving         powerSavingMode
+	lastActivity        time.Time
+	trace               TraceFunc
+	requestInterceptors []RequestInterceptor
+	indicationHandler   IndicationHandler
+	mutex               *sync.Mutex
 }
 
 type WiModControllerConfig struct {
 	Stream          io.ReadWriteCloser
 	EventBufferSize int
 	EventNoBlock    bool
+	// RequestTimeout bounds Request, DefaultRequestTimeout if zero and none
+	// if negative.
+	RequestTimeout time.Duration
+	// IndicationTimeout bounds ReadInd and ReadSpecificInd,
+	// DefaultIndicationTimeout if zero and none if negative.
+	IndicationTimeout time.Duration
+	// RequestQueueSize bounds the requests waiting for the one in flight,
+	// DefaultRequestQueueSize if zero.
+	RequestQueueSize int
+	// Dial reopens the stream when it fails, or opens it if Stream is nil.
+	Dial func() (io.ReadWriteCloser, error)
+	// ReconnectBackoff is waited before the first reconnection attempt and
+	// doubled, up to MaxReconnectBackoff, after every failed one.
+	ReconnectBackoff    time.Duration
+	MaxReconnectBackoff time.Duration
+	// Logger defaults to slog.Default().
+	Logger *slog.Logger
+	// Trace, if set, receives every packet sent or received.
+	Trace TraceFunc
+	// WakeUpLength is the number of SLIP_END bytes sent ahead of a request
+	// to a possibly sleeping modem, DefaultWakeUpLength if zero and none if
+	// negative.
+	WakeUpLength int
+	// WakeUpIdleThreshold is the idle time after which the modem may be
+	// sleeping, DefaultWakeUpIdleThreshold if zero.
+	WakeUpIdleThreshold time.Duration
+	// RequestInterceptors wrap, in order, the sending of every request.
+	RequestInterceptors []RequestInterceptor
+	// IndicationInterceptors wrap, in order, the delivery of every
+	// indication.
+	IndicationInterceptors []IndicationInterceptor
 }
 
+const (
+	DefaultRequestTimeout    = 5 * time.Second
+	DefaultIndicationTimeout = 30 * time.Second
+)
+
 func NewController(config *WiModControllerConfig) *WiModController {
-	slipDecoder := slip.NewDecoder(config.Stream)
 	respChannels := make(map[uint16][]chan hci.HCIPacket)
 	eventChannels := make(map[uint16][]chan hci.HCIPacket)
 	eventBufferSize := 10
@@ -36,149 +103,352 @@ func NewController(config *WiModControllerConfig) *WiModController {
 		eventBufferSize = config.EventBufferSize
 	}
 	events := make(chan hci.HCIPacket, eventBufferSize)
-	closer := make(chan bool, 1)
-	controller := &WiModController{config.Stream, &slipDecoder, closer, events, respChannels, eventChannels, config.EventNoBlock, &sync.Mutex{}}
-	go controller.start()
-	go controller.eventDispatcher()
+	requestTimeout := DefaultRequestTimeout
+	if config.RequestTimeout != 0 {
+		requestTimeout = config.RequestTimeout
+	}
+	indTimeout := DefaultIndicationTimeout
+	if config.IndicationTimeout != 0 {
+		indTimeout = config.IndicationTimeout
+	}
+	requestQueueSize := DefaultRequestQueueSize
+	if config.RequestQueueSize != 0 {
+		requestQueueSize = config.RequestQueueSize
+	}
+	reconnectBackoff := DefaultReconnectBackoff
+	if config.ReconnectBackoff != 0 {
+		reconnectBackoff = config.ReconnectBackoff
+	}
+	maxReconnectBackoff := DefaultMaxReconnectBackoff
+	if config.MaxReconnectBackoff != 0 {
+		maxReconnectBackoff = config.MaxReconnectBackoff
+	}
+	wakeUpLength := DefaultWakeUpLength
+	if config.WakeUpLength != 0 {
+		wakeUpLength = config.WakeUpLength
+	}
+	wakeUpIdleThreshold := DefaultWakeUpIdleThreshold
+	if config.WakeUpIdleThreshold != 0 {
+		wakeUpIdleThreshold = config.WakeUpIdleThreshold
+	}
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	lost := make(chan bool)
+	close(lost)
+	controller := &WiModController{
+		closing:             make(chan struct{}),
+		done:                make(chan struct{}),
+		events:              events,
+		respChannels:        respChannels,
+		eventChannels:       eventChannels,
+		noBlock:             config.EventNoBlock,
+		requestTimeout:      requestTimeout,
+		indTimeout:          indTimeout,
+		dial:                config.Dial,
+		reconnectBackoff:    reconnectBackoff,
+		maxReconnectBackoff: maxReconnectBackoff,
+		lost:                lost,
+		logger:              logger,
+		trace:               config.Trace,
+		requestInterceptors: config.RequestInterceptors,
+		wakeUpLength:        wakeUpLength,
+		wakeUpIdleThreshold: wakeUpIdleThreshold,
+		mutex:               &sync.Mutex{},
+	}
+	controller.indicationHandler = chainIndication(config.IndicationInterceptors, controller.dispatchIndication)
+	controller.queue = newRequestQueue(requestQueueSize, controller.closing, controller.Err)
+	if config.Stream != nil {
+		controller.connect(config.Stream)
+	}
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		controller.start()
+	}()
+	go func() {
+		defer wg.Done()
+		controller.eventDispatcher()
+	}()
+	go func() {
+		wg.Wait()
+		close(controller.done)
+	}()
 	return controller
 }
 
+// start reads from the stream, reconnecting if possible, until the
+// controller is closed. It closes the controller if the stream is lost and
+// cannot be reopened.
 func (c *WiModController) start() {
+	if c.ConnectionState() != ConnectionConnected {
+		if c.dial == nil {
+			c.closeWith(&DisconnectedError{})
+			return
+		}
+		if !c.reconnect() {
+			return
+		}
+	}
+	for {
+		err := c.readPackets()
+		c.mutex.Lock()
+		closed := c.closed
+		c.mutex.Unlock()
+		if closed {
+			return
+		}
+		c.disconnect(err)
+		if c.dial == nil {
+			c.closeWith(&DisconnectedError{Err: err})
+			return
+		}
+		if !c.reconnect() {
+			return
+		}
+	}
+}
+
+// readPackets dispatches the packets received until the stream fails.
+func (c *WiModController) readPackets() error {
+	c.mutex.Lock()
+	frames := c.frames
+	c.mutex.Unlock()
 	hciPacket := hci.HCIPacket{}
-	run := true
-	for run {
+	for {
+		var payload []byte
 		select {
-		case <-c.closer:
-			run = false
-			break
-		default:
-			payload, err := c.slipDecoder.Read()
-			if len(payload) == 0 {
-				continue
-			}
-			if err != nil {
-				fmt.Printf("Error: %s\n", err.Error())
-				continue
-			}
-			err = hciPacket.Decode(payload)
-			if err != nil {
-				fmt.Printf("Error: %s\n", err.Error())
+		case frame := <-frames:
+			if frame.err != nil {
+				var framingErr *slip.FramingError
+				if !errors.As(frame.err, &framingErr) {
+					return frame.err
+				}
+				c.stats.framingErrors.Add(1)
+				c.logger.Warn("discarding invalid slip frame", slog.Int("length", framingErr.Length), slog.Any("error", framingErr.Err))
 				continue
 			}
-			code := (uint16(hciPacket.Dst) << 8) + uint16(hciPacket.ID)
-			if wimod.IsAlarm(code) {
-				if c.noBlock && len(c.events) == cap(c.events) {
-					discarded := <-c.events
-					fmt.Printf("Event buffer full. Discarding oldest event: [%02X%02X]\n", discarded.Dst, discarded.ID)
+			payload = frame.payload
+		case <-c.closing:
+			return nil
+		}
+		err := hciPacket.Decode(payload)
+		if err != nil {
+			c.stats.crcErrors.Add(1)
+			c.logger.Warn("discarding invalid hci packet", slog.Int("length", len(payload)), slog.Any("error", err))
+			continue
+		}
+		c.stats.packetsIn.Add(1)
+		c.touch()
+		c.tracePacket(DirectionRx, hciPacket)
+		code := (uint16(hciPacket.Dst) << 8) + uint16(hciPacket.ID)
+		if wimod.IsAlarm(code) {
+			if c.noBlock && len(c.events) == cap(c.events) {
+				select {
+				case discarded := <-c.events:
+					c.stats.droppedEvents.Add(1)
+					c.logger.Warn("event buffer full, discarding oldest event", packetAttrs(DirectionRx, discarded)...)
+				default:
 				}
-				c.events <- hciPacket
-				continue
 			}
-			c.mutex.Lock()
-			channels, ok := c.respChannels[code]
-			if !ok {
-				fmt.Printf("Discarded packet because no listener: %v\n", hciPacket)
-				c.mutex.Unlock()
-				continue
+			select {
+			case c.events <- hciPacket:
+			case <-c.closing:
+				return nil
 			}
-			respChannel := channels[0]
-			respChannel <- hciPacket
-			close(respChannel)
-			channels[0] = nil
-			channels = channels[1:]
-			c.respChannels[code] = channels
+			continue
+		}
+		c.mutex.Lock()
+		channels := c.respChannels[code]
+		if len(channels) == 0 {
+			c.stats.discardedPackets.Add(1)
+			c.logger.Warn("discarding packet without listener", packetAttrs(DirectionRx, hciPacket)...)
 			c.mutex.Unlock()
+			continue
 		}
+		respChannel := channels[0]
+		respChannel <- hciPacket
+		close(respChannel)
+		channels[0] = nil
+		channels = channels[1:]
+		c.respChannels[code] = channels
+		c.mutex.Unlock()
 	}
 }
 
 func (c *WiModController) eventDispatcher() {
-	for event := range c.events {
-		code := (uint16(event.Dst) << 8) + uint16(event.ID)
-		c.mutex.Lock()
-		channels := c.eventChannels[code]
-		channelsAll := c.eventChannels[0]
-		c.eventChannels[0] = nil
-		c.eventChannels[code] = nil
-		channels = append(channels, channelsAll...)
-		for _, channel := range channels {
-			channel <- event
-			close(channel)
+	for {
+		var event hci.HCIPacket
+		select {
+		case event = <-c.events:
+		case <-c.closing:
+			return
 		}
-		c.mutex.Unlock()
+		c.indicationHandler(event)
 	}
 }
 
-func (c *WiModController) Close() {
-	c.closer <- true
-	c.slipDecoder.Close()
-	c.rwc.Close()
-	close(c.closer)
-	close(c.events)
+func (c *WiModController) dispatchIndication(event hci.HCIPacket) {
+	code := (uint16(event.Dst) << 8) + uint16(event.ID)
+	c.mutex.Lock()
+	c.trackRxOutcome(code, event)
+	channels := c.eventChannels[code]
+	channelsAll := c.eventChannels[0]
+	c.eventChannels[0] = nil
+	c.eventChannels[code] = nil
+	channels = append(channels, channelsAll...)
+	for _, channel := range channels {
+		channel <- event
+		close(channel)
+	}
+	c.mutex.Unlock()
+	c.publish(code, event)
 }
 
 func (c *WiModController) Request(req wimod.WiModMessageReq, resp wimod.WiModMessageResp) error {
+	ctx, cancel := withTimeout(c.requestTimeout)
+	defer cancel()
+	return c.RequestContext(ctx, req, resp)
+}
+
+func (c *WiModController) RequestContext(ctx context.Context, req wimod.WiModMessageReq, resp wimod.WiModMessageResp) error {
 	req.Init()
 	resp.Init()
-	respChannel := make(chan hci.HCIPacket)
-	c.mutex.Lock()
-	channels, ok := c.respChannels[resp.Code()]
-	if !ok {
-		channels = []chan hci.HCIPacket{}
+	return c.intercept(ctx, req, resp, func(ctx context.Context, req wimod.WiModMessageReq, resp wimod.WiModMessageResp) error {
+		latency, err := c.request(ctx, req, resp)
+		c.stats.observeRequest(req.Code(), latency, err)
+		return err
+	})
+}
+
+// request returns the time it took to receive the response, if it did.
+func (c *WiModController) request(ctx context.Context, req wimod.WiModMessageReq, resp wimod.WiModMessageResp) (time.Duration, error) {
+	err := c.queue.acquire(ctx, RequestPriority(req.Code()))
+	if err != nil {
+		return 0, err
 	}
-	channels = append(channels, respChannel)
-	c.respChannels[resp.Code()] = channels
-	c.mutex.Unlock()
-	err := c.sendReq(req)
+	defer c.queue.release()
+	respChannel := make(chan hci.HCIPacket, 1)
+	c.addListener(c.respChannels, resp.Code(), respChannel)
+	defer c.removeListener(c.respChannels, resp.Code(), respChannel)
+	lost, err := c.sendReq(req)
 	if err != nil {
-		return err
+		return 0, err
+	}
+	sentAt := time.Now()
+	select {
+	case hci := <-respChannel:
+		latency := time.Since(sentAt)
+		err = wimod.DecodeResp(&hci, resp)
+		if err == nil {
+			c.trackPowerSaving(req, resp)
+		}
+		return latency, err
+	case <-lost:
+		return 0, c.disconnectedError()
+	case <-c.closing:
+		return 0, c.Err()
+	case <-ctx.Done():
+		return 0, fmt.Errorf("waiting for response 0x%04X: %w", resp.Code(), ctx.Err())
 	}
-	hci := <-respChannel
-	return wimod.DecodeResp(&hci, resp)
 }
 
 func (c *WiModController) ReadInd() (wimod.WiModMessageInd, error) {
-	eventChannel := make(chan hci.HCIPacket)
-	c.mutex.Lock()
-	channels, ok := c.eventChannels[0]
-	if !ok {
-		channels = []chan hci.HCIPacket{}
+	ctx, cancel := withTimeout(c.indTimeout)
+	defer cancel()
+	return c.ReadIndContext(ctx)
+}
+
+func (c *WiModController) ReadIndContext(ctx context.Context) (wimod.WiModMessageInd, error) {
+	eventChannel := make(chan hci.HCIPacket, 1)
+	c.addListener(c.eventChannels, 0, eventChannel)
+	defer c.removeListener(c.eventChannels, 0, eventChannel)
+	select {
+	case hci := <-eventChannel:
+		return wimod.DecodeInd(&hci)
+	case <-c.closing:
+		return nil, c.Err()
+	case <-ctx.Done():
+		return nil, fmt.Errorf("waiting for indication: %w", ctx.Err())
 	}
-	channels = append(channels, eventChannel)
-	c.eventChannels[0] = channels
-	c.mutex.Unlock()
-	hci := <-eventChannel
-	return wimod.DecodeInd(&hci)
 }
 
 func (c *WiModController) ReadSpecificInd(ind wimod.WiModMessageInd) error {
+	ctx, cancel := withTimeout(c.indTimeout)
+	defer cancel()
+	return c.ReadSpecificIndContext(ctx, ind)
+}
+
+func (c *WiModController) ReadSpecificIndContext(ctx context.Context, ind wimod.WiModMessageInd) error {
 	ind.Init()
-	eventChannel := make(chan hci.HCIPacket)
-	c.mutex.Lock()
-	channels, ok := c.eventChannels[ind.Code()]
-	if !ok {
-		channels = []chan hci.HCIPacket{}
+	eventChannel := make(chan hci.HCIPacket, 1)
+	c.addListener(c.eventChannels, ind.Code(), eventChannel)
+	defer c.removeListener(c.eventChannels, ind.Code(), eventChannel)
+	select {
+	case hci := <-eventChannel:
+		return wimod.DecodeSpecificInd(&hci, ind)
+	case <-c.closing:
+		return c.Err()
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for indication 0x%04X: %w", ind.Code(), ctx.Err())
 	}
-	channels = append(channels, eventChannel)
-	c.eventChannels[ind.Code()] = channels
+}
+
+func (c *WiModController) addListener(listeners map[uint16][]chan hci.HCIPacket, code uint16, channel chan hci.HCIPacket) {
+	c.mutex.Lock()
+	listeners[code] = append(listeners[code], channel)
 	c.mutex.Unlock()
-	hci := <-eventChannel
-	return wimod.DecodeSpecificInd(&hci, ind)
 }
 
-func (c *WiModController) sendReq(req wimod.WiModMessageReq) error {
-	hci, err := wimod.EncodeReq(req)
-	if err != nil {
-		return err
+// removeListener is a no-op if the listener was already served.
+func (c *WiModController) removeListener(listeners map[uint16][]chan hci.HCIPacket, code uint16, channel chan hci.HCIPacket) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	channels := listeners[code]
+	for i, ch := range channels {
+		if ch == channel {
+			listeners[code] = append(channels[:i:i], channels[i+1:]...)
+			return
+		}
+	}
+}
+
+func withTimeout(timeout time.Duration) (context.Context, context.CancelFunc) {
+	return withParentTimeout(context.Background(), timeout)
+}
+
+func withParentTimeout(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(parent)
 	}
-	slipPacket := slip.SlipEncode(hci.Encode())
-	sendWakeUp(c.rwc)
-	_, err = c.rwc.Write(slipPacket)
-	return err
+	return context.WithTimeout(parent, timeout)
 }
 
-func sendWakeUp(rw io.ReadWriter) {
-	for i := 0; i < 40; i++ {
-		rw.Write([]byte{slip.SLIP_END})
+// sendReq returns a channel closed once the connection the request was sent
+// through is lost.
+func (c *WiModController) sendReq(req wimod.WiModMessageReq) (chan bool, error) {
+	hci, err := wimod.EncodeReq(req)
+	if err != nil {
+		return nil, err
+	}
+	rwc, lost := c.connection()
+	select {
+	case <-c.closing:
+		return nil, c.Err()
+	default:
+	}
+	if rwc == nil {
+		return nil, c.disconnectedError()
+	}
+	c.tracePacket(DirectionTx, *hci)
+	n, err := rwc.Write(append(c.wakeUpPreamble(), slip.SlipEncode(hci.Encode())...))
+	c.stats.bytesOut.Add(uint64(n))
+	if err != nil {
+		return nil, &DisconnectedError{Err: err}
 	}
+	c.stats.packetsOut.Add(1)
+	c.touch()
+	return lost, nil
 }
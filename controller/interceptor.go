@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/enolgor/wimod-lorawan-endnode-controller/hci"
+	"github.com/enolgor/wimod-lorawan-endnode-controller/wimod"
+)
+
+// RequestHandler sends req and decodes its response into resp.
+type RequestHandler func(ctx context.Context, req wimod.WiModMessageReq, resp wimod.WiModMessageResp) error
+
+// RequestInterceptor wraps every request, including the ones of a
+// Transaction. It may change req before calling next, inspect or change resp
+// and the error after it, or not call next at all, filling resp itself, to
+// short-circuit the request. req is already initialized when it is called.
+type RequestInterceptor func(ctx context.Context, req wimod.WiModMessageReq, resp wimod.WiModMessageResp, next RequestHandler) error
+
+// IndicationHandler delivers an inbound indication to the readers,
+// listeners and subscriptions waiting for it.
+type IndicationHandler func(packet hci.HCIPacket)
+
+// IndicationInterceptor wraps the delivery of every inbound indication, it
+// may change the packet before calling next, replacing its Payload rather
+// than modifying it as it is shared with the trace, or drop it by not calling
+// next. It is called from the controller goroutine, so it should not block.
+type IndicationInterceptor func(packet hci.HCIPacket, next IndicationHandler)
+
+func (c *WiModController) intercept(ctx context.Context, req wimod.WiModMessageReq, resp wimod.WiModMessageResp, handler RequestHandler) error {
+	return chainRequest(c.requestInterceptors, handler)(ctx, req, resp)
+}
+
+// chainRequest returns handler wrapped by the interceptors, the first one
+// being the outermost.
+func chainRequest(interceptors []RequestInterceptor, handler RequestHandler) RequestHandler {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(ctx context.Context, req wimod.WiModMessageReq, resp wimod.WiModMessageResp) error {
+			return interceptor(ctx, req, resp, next)
+		}
+	}
+	return handler
+}
+
+// chainIndication returns handler wrapped by the interceptors, the first one
+// being the outermost.
+func chainIndication(interceptors []IndicationInterceptor, handler IndicationHandler) IndicationHandler {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(packet hci.HCIPacket) {
+			interceptor(packet, next)
+		}
+	}
+	return handler
+}
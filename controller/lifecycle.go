@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var ErrClosed = errors.New("controller closed")
+
+// Run blocks until ctx is done, closing the controller then, or until the
+// controller is closed otherwise, and returns Err once it has shut down.
+func (c *WiModController) Run(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		c.closeWith(ErrClosed)
+	case <-c.closing:
+	}
+	<-c.done
+	return c.Err()
+}
+
+// Done is closed once the controller is closed and its goroutines are gone.
+func (c *WiModController) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns nil while the controller is open, ErrClosed once it is closed
+// and, if it was closed because the stream was lost and could not be
+// reopened, an error wrapping both ErrClosed and the DisconnectedError.
+func (c *WiModController) Err() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.err
+}
+
+// Close shuts the controller down and waits for its goroutines to exit.
+// Pending requests, indication reads and subscriptions fail with Err.
+func (c *WiModController) Close() error {
+	c.closeWith(ErrClosed)
+	<-c.done
+	return nil
+}
+
+func (c *WiModController) closeWith(err error) {
+	c.closeOnce.Do(func() {
+		if err != ErrClosed {
+			err = fmt.Errorf("%w: %w", ErrClosed, err)
+		}
+		c.mutex.Lock()
+		c.closed = true
+		c.err = err
+		rwc := c.rwc
+		subscriptions := c.subscriptions
+		for _, channel := range c.connWatchers {
+			close(channel)
+		}
+		c.connWatchers = nil
+		for _, channel := range c.rxOutcomeWatchers {
+			close(channel)
+		}
+		c.rxOutcomeWatchers = nil
+		for _, watcher := range c.indWatchers {
+			close(watcher.channel)
+		}
+		c.indWatchers = nil
+		c.mutex.Unlock()
+		close(c.closing)
+		if rwc != nil {
+			rwc.Close()
+		}
+		for _, s := range subscriptions {
+			s.cancel(err)
+		}
+	})
+}
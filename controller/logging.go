@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/enolgor/wimod-lorawan-endnode-controller/hci"
+	"github.com/enolgor/wimod-lorawan-endnode-controller/wimod"
+)
+
+type Direction byte
+
+const (
+	DirectionTx Direction = iota + 1
+	DirectionRx
+)
+
+func (d Direction) String() string {
+	switch d {
+	case DirectionTx:
+		return "tx"
+	case DirectionRx:
+		return "rx"
+	}
+	return "unknown"
+}
+
+// TraceFunc is called from the controller goroutines with every packet sent
+// or received, so it should not block. The packet payload is shared with the
+// rest of the controller and must not be modified or kept past the call.
+type TraceFunc func(direction Direction, packet hci.HCIPacket)
+
+func packetAttrs(direction Direction, packet hci.HCIPacket) []any {
+	code := (uint16(packet.Dst) << 8) + uint16(packet.ID)
+	return []any{
+		slog.String("direction", direction.String()),
+		slog.String("code", fmt.Sprintf("0x%04X", code)),
+		slog.String("message", wimod.MessageName(code)),
+		slog.Int("length", len(packet.Payload)),
+	}
+}
+
+// tracePacket builds the log attributes only if they are going to be used,
+// as it runs for every packet.
+func (c *WiModController) tracePacket(direction Direction, packet hci.HCIPacket) {
+	if c.logger.Enabled(context.Background(), slog.LevelDebug) {
+		c.logger.Debug("hci packet", packetAttrs(direction, packet)...)
+	}
+	if c.trace != nil {
+		c.trace(direction, packet)
+	}
+}
@@ -0,0 +1,172 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/enolgor/wimod-lorawan-endnode-controller/wimod"
+)
+
+type Priority byte
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "high"
+	}
+	return "unknown"
+}
+
+const DefaultRequestQueueSize = 16
+
+var ErrQueueFull = errors.New("request queue full")
+
+// RequestPriority puts device management ahead of LoRaWAN configuration and
+// network requests, and those ahead of uplinks.
+func RequestPriority(code uint16) Priority {
+	switch code {
+	case wimod.LORAWAN_MSG_SEND_UDATA_REQ, wimod.LORAWAN_MSG_SEND_CDATA_REQ, wimod.LORAWAN_MSG_SEND_MAC_CMD_REQ:
+		return PriorityLow
+	}
+	if byte(code>>8) == wimod.DEVMGMT_ID {
+		return PriorityHigh
+	}
+	return PriorityNormal
+}
+
+// QueueStats reports the requests waiting for the modem. Served counts the
+// requests that got to be sent and TotalWait and MaxWait the time they spent
+// queued. Rejected counts the requests refused because the queue was full.
+type QueueStats struct {
+	Depth     int
+	Capacity  int
+	InFlight  bool
+	Served    uint64
+	Rejected  uint64
+	TotalWait time.Duration
+	MaxWait   time.Duration
+}
+
+func (s QueueStats) AverageWait() time.Duration {
+	if s.Served == 0 {
+		return 0
+	}
+	return s.TotalWait / time.Duration(s.Served)
+}
+
+type queuedRequest struct {
+	ready    chan bool
+	enqueued time.Time
+}
+
+// requestQueue lets a single request at a time be sent to the modem and
+// wait for its response.
+type requestQueue struct {
+	closing <-chan struct{}
+	err     func() error
+	mutex   sync.Mutex
+	size    int
+	busy    bool
+	waiting [PriorityHigh + 1][]*queuedRequest
+	stats   QueueStats
+}
+
+// The requests waiting when closing is closed fail with the error returned by
+// err.
+func newRequestQueue(size int, closing <-chan struct{}, err func() error) *requestQueue {
+	return &requestQueue{closing: closing, err: err, size: size, stats: QueueStats{Capacity: size}}
+}
+
+func (q *requestQueue) acquire(ctx context.Context, priority Priority) error {
+	q.mutex.Lock()
+	if !q.busy {
+		q.busy = true
+		q.stats.Served++
+		q.mutex.Unlock()
+		return nil
+	}
+	if q.stats.Depth >= q.size {
+		q.stats.Rejected++
+		q.mutex.Unlock()
+		return ErrQueueFull
+	}
+	request := &queuedRequest{ready: make(chan bool), enqueued: time.Now()}
+	q.waiting[priority] = append(q.waiting[priority], request)
+	q.stats.Depth++
+	q.mutex.Unlock()
+	var err error
+	select {
+	case <-request.ready:
+		return nil
+	case <-q.closing:
+		err = q.err()
+	case <-ctx.Done():
+		err = fmt.Errorf("waiting for request slot: %w", ctx.Err())
+	}
+	q.mutex.Lock()
+	removed := false
+	for i, r := range q.waiting[priority] {
+		if r == request {
+			q.waiting[priority] = append(q.waiting[priority][:i:i], q.waiting[priority][i+1:]...)
+			q.stats.Depth--
+			removed = true
+			break
+		}
+	}
+	q.mutex.Unlock()
+	if !removed {
+		// the slot was granted while giving up, hand it over
+		q.release()
+	}
+	return err
+}
+
+func (q *requestQueue) release() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for p := PriorityHigh; ; p-- {
+		if len(q.waiting[p]) > 0 {
+			request := q.waiting[p][0]
+			q.waiting[p][0] = nil
+			q.waiting[p] = q.waiting[p][1:]
+			wait := time.Since(request.enqueued)
+			q.stats.Depth--
+			q.stats.Served++
+			q.stats.TotalWait += wait
+			if wait > q.stats.MaxWait {
+				q.stats.MaxWait = wait
+			}
+			close(request.ready)
+			return
+		}
+		if p == PriorityLow {
+			break
+		}
+	}
+	q.busy = false
+}
+
+func (q *requestQueue) snapshot() QueueStats {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	stats := q.stats
+	stats.InFlight = q.busy
+	return stats
+}
+
+func (c *WiModController) QueueStats() QueueStats {
+	return c.queue.snapshot()
+}
@@ -0,0 +1,158 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/enolgor/wimod-lorawan-endnode-controller/hci"
+	"github.com/enolgor/wimod-lorawan-endnode-controller/wimod"
+)
+
+type RxOutcomeType byte
+
+const (
+	RxOutcomeData RxOutcomeType = iota + 1
+	RxOutcomeAck
+	RxOutcomeNoData
+)
+
+func (t RxOutcomeType) String() string {
+	switch t {
+	case RxOutcomeData:
+		return "data"
+	case RxOutcomeAck:
+		return "ack"
+	case RxOutcomeNoData:
+		return "no-data"
+	}
+	return "unknown"
+}
+
+// RxOutcome reports how the RX windows following an uplink were closed.
+// UplinkCode is the TX indication of the uplink, IndCode the indication
+// that closed the windows, ErrorCode the RecvNoDataInd error code, if any,
+// and Metadata the Rx channel info of the closing indication, if attached.
+type RxOutcome struct {
+	Type       RxOutcomeType
+	UplinkCode uint16
+	IndCode    uint16
+	ErrorCode  byte
+	Metadata   wimod.RxMetadata
+}
+
+func (o RxOutcome) String() string {
+	return fmt.Sprintf("RxOutcome[Type: %s, UplinkCode: 0x%04X, IndCode: 0x%04X, ErrorCode: %08b]", o.Type, o.UplinkCode, o.IndCode, o.ErrorCode)
+}
+
+// trackRxOutcome must be called with the mutex held. Only the uplinks their
+// TX indication reports as sent open RX windows.
+func (c *WiModController) trackRxOutcome(code uint16, event hci.HCIPacket) {
+	switch code {
+	case wimod.LORAWAN_MSG_SEND_UDATA_TX_IND, wimod.LORAWAN_MSG_SEND_CDATA_TX_IND:
+		if _, err := wimod.DecodeInd(&event); err == nil {
+			c.pendingUplink = code
+		}
+		return
+	}
+	if c.pendingUplink == 0 {
+		return
+	}
+	ind, err := wimod.DecodeInd(&event)
+	if err != nil {
+		return
+	}
+	outcome := RxOutcome{UplinkCode: c.pendingUplink, IndCode: code}
+	switch ind := ind.(type) {
+	case *wimod.RecvUDataInd:
+		outcome.Type = rxDataOutcomeType(ind.Ack, ind.Payload)
+	case *wimod.RecvCDataInd:
+		outcome.Type = rxDataOutcomeType(ind.Ack, ind.Payload)
+	case *wimod.RecvAckInd:
+		outcome.Type = RxOutcomeAck
+	case *wimod.RecvNoDataInd:
+		outcome.Type = RxOutcomeNoData
+		outcome.ErrorCode = ind.ErrorCode
+	default:
+		return
+	}
+	if rx, ok := ind.(wimod.RxIndication); ok {
+		outcome.Metadata = *rx.RxInfo()
+	}
+	c.pendingUplink = 0
+	for _, channel := range c.rxOutcomeChannels {
+		channel <- outcome
+		close(channel)
+	}
+	c.rxOutcomeChannels = nil
+	for _, channel := range c.rxOutcomeWatchers {
+		select {
+		case channel <- outcome:
+		default:
+		}
+	}
+}
+
+func rxDataOutcomeType(ack bool, payload []byte) RxOutcomeType {
+	if ack && len(payload) == 0 {
+		return RxOutcomeAck
+	}
+	return RxOutcomeData
+}
+
+// ReadRxOutcome is ReadRxOutcomeContext bounded by the indication timeout.
+func (c *WiModController) ReadRxOutcome() (RxOutcome, error) {
+	ctx, cancel := withTimeout(c.indTimeout)
+	defer cancel()
+	return c.ReadRxOutcomeContext(ctx)
+}
+
+// ReadRxOutcomeContext waits for the next RX outcome before ctx is done. Only
+// the outcomes from the call on are seen, so that of an uplink sent before may
+// be missed; use WatchRxOutcomes before sending it instead.
+func (c *WiModController) ReadRxOutcomeContext(ctx context.Context) (RxOutcome, error) {
+	outcomeChannel := make(chan RxOutcome, 1)
+	c.mutex.Lock()
+	c.rxOutcomeChannels = append(c.rxOutcomeChannels, outcomeChannel)
+	c.mutex.Unlock()
+	select {
+	case outcome := <-outcomeChannel:
+		return outcome, nil
+	case <-c.closing:
+		return RxOutcome{}, c.Err()
+	case <-ctx.Done():
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for i, ch := range c.rxOutcomeChannels {
+		if ch == outcomeChannel {
+			c.rxOutcomeChannels = append(c.rxOutcomeChannels[:i:i], c.rxOutcomeChannels[i+1:]...)
+			break
+		}
+	}
+	return RxOutcome{}, fmt.Errorf("waiting for rx outcome: %w", ctx.Err())
+}
+
+// WatchRxOutcomes returns the RX outcomes from now on until the returned
+// function is called or the controller is closed. Outcomes are dropped if the
+// channel is full.
+func (c *WiModController) WatchRxOutcomes() (<-chan RxOutcome, func()) {
+	channel := make(chan RxOutcome, 10)
+	c.mutex.Lock()
+	if c.closed {
+		close(channel)
+	} else {
+		c.rxOutcomeWatchers = append(c.rxOutcomeWatchers, channel)
+	}
+	c.mutex.Unlock()
+	return channel, func() {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		for i, ch := range c.rxOutcomeWatchers {
+			if ch == channel {
+				c.rxOutcomeWatchers = append(c.rxOutcomeWatchers[:i:i], c.rxOutcomeWatchers[i+1:]...)
+				close(channel)
+				return
+			}
+		}
+	}
+}
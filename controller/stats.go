@@ -0,0 +1,191 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/enolgor/wimod-lorawan-endnode-controller/wimod"
+)
+
+// LatencyBuckets are the upper bounds of the request latency histogram
+// buckets, the last bucket counts the requests above the last bound.
+var LatencyBuckets = []time.Duration{
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+}
+
+type LatencyHistogram struct {
+	Buckets []uint64
+	Count   uint64
+	Sum     time.Duration
+	Max     time.Duration
+}
+
+func (h *LatencyHistogram) observe(latency time.Duration) {
+	if h.Buckets == nil {
+		h.Buckets = make([]uint64, len(LatencyBuckets)+1)
+	}
+	i := 0
+	for i < len(LatencyBuckets) && latency > LatencyBuckets[i] {
+		i++
+	}
+	h.Buckets[i]++
+	h.Count++
+	h.Sum += latency
+	if latency > h.Max {
+		h.Max = latency
+	}
+}
+
+func (h LatencyHistogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// Stats is a snapshot of the controller activity since it was created.
+// Latency holds the time from sending a request to receiving its response,
+// by request message name, and the Pending counts are the listeners
+// currently waiting for a response, an indication or an Rx outcome.
+// RequestTimeouts counts the requests the modem did not answer in time and
+// IndicationTimeouts the transactions answered but whose indications did not
+// arrive in time.
+type Stats struct {
+	ConnectionState     string
+	BytesIn             uint64
+	BytesOut            uint64
+	PacketsIn           uint64
+	PacketsOut          uint64
+	CRCErrors           uint64
+	FramingErrors       uint64
+	DiscardedPackets    uint64
+	DroppedEvents       uint64
+	Reconnections       uint64
+	Requests            uint64
+	RequestErrors       uint64
+	RequestTimeouts     uint64
+	IndicationTimeouts  uint64
+	PendingResponses    int
+	PendingIndications  int
+	PendingRxOutcomes   int
+	Subscriptions       int
+	SubscriptionDropped uint64
+	Queue               QueueStats
+	Latency             map[string]LatencyHistogram
+}
+
+type controllerStats struct {
+	bytesIn          atomic.Uint64
+	bytesOut         atomic.Uint64
+	packetsIn        atomic.Uint64
+	packetsOut       atomic.Uint64
+	crcErrors        atomic.Uint64
+	framingErrors    atomic.Uint64
+	discardedPackets atomic.Uint64
+	droppedEvents    atomic.Uint64
+	reconnections    atomic.Uint64
+	requests         atomic.Uint64
+	requestErrors    atomic.Uint64
+	requestTimeouts  atomic.Uint64
+	indTimeouts      atomic.Uint64
+	mutex            sync.Mutex
+	latency          map[uint16]*LatencyHistogram
+}
+
+func (s *controllerStats) observeLatency(code uint16, latency time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.latency == nil {
+		s.latency = make(map[uint16]*LatencyHistogram)
+	}
+	h, ok := s.latency[code]
+	if !ok {
+		h = &LatencyHistogram{}
+		s.latency[code] = h
+	}
+	h.observe(latency)
+}
+
+// observeRequest records the outcome of a request, and the latency of its
+// response if it was received. A timeout once the response was received is
+// one waiting for the indications of a transaction.
+func (s *controllerStats) observeRequest(code uint16, latency time.Duration, err error) {
+	s.requests.Add(1)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) && latency > 0:
+		s.indTimeouts.Add(1)
+	case errors.Is(err, context.DeadlineExceeded):
+		s.requestTimeouts.Add(1)
+	case err != nil:
+		s.requestErrors.Add(1)
+	}
+	if latency > 0 {
+		s.observeLatency(code, latency)
+	}
+}
+
+type countingReader struct {
+	io.Reader
+	count *atomic.Uint64
+}
+
+func (r countingReader) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	r.count.Add(uint64(n))
+	return n, err
+}
+
+func (c *WiModController) Stats() Stats {
+	stats := Stats{
+		BytesIn:            c.stats.bytesIn.Load(),
+		BytesOut:           c.stats.bytesOut.Load(),
+		PacketsIn:          c.stats.packetsIn.Load(),
+		PacketsOut:         c.stats.packetsOut.Load(),
+		CRCErrors:          c.stats.crcErrors.Load(),
+		FramingErrors:      c.stats.framingErrors.Load(),
+		DiscardedPackets:   c.stats.discardedPackets.Load(),
+		DroppedEvents:      c.stats.droppedEvents.Load(),
+		Reconnections:      c.stats.reconnections.Load(),
+		Requests:           c.stats.requests.Load(),
+		RequestErrors:      c.stats.requestErrors.Load(),
+		RequestTimeouts:    c.stats.requestTimeouts.Load(),
+		IndicationTimeouts: c.stats.indTimeouts.Load(),
+		Queue:              c.QueueStats(),
+		Latency:            make(map[string]LatencyHistogram),
+	}
+	c.mutex.Lock()
+	stats.ConnectionState = c.state.String()
+	for _, channels := range c.respChannels {
+		stats.PendingResponses += len(channels)
+	}
+	for _, channels := range c.eventChannels {
+		stats.PendingIndications += len(channels)
+	}
+	stats.PendingRxOutcomes = len(c.rxOutcomeChannels)
+	subscriptions := append([]*Subscription{}, c.subscriptions...)
+	c.mutex.Unlock()
+	stats.Subscriptions = len(subscriptions)
+	for _, s := range subscriptions {
+		stats.SubscriptionDropped += s.Dropped()
+	}
+	c.stats.mutex.Lock()
+	for code, h := range c.stats.latency {
+		histogram := *h
+		histogram.Buckets = append([]uint64(nil), h.Buckets...)
+		stats.Latency[wimod.MessageName(code)] = histogram
+	}
+	c.stats.mutex.Unlock()
+	return stats
+}
@@ -0,0 +1,230 @@
+package controller
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+
+	"github.com/enolgor/wimod-lorawan-endnode-controller/hci"
+	"github.com/enolgor/wimod-lorawan-endnode-controller/wimod"
+)
+
+type OverflowPolicy byte
+
+const (
+	OverflowDropOldest OverflowPolicy = iota
+	OverflowDropNewest
+	OverflowBlock
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowDropOldest:
+		return "drop-oldest"
+	case OverflowDropNewest:
+		return "drop-newest"
+	case OverflowBlock:
+		return "block"
+	}
+	return "unknown"
+}
+
+// SubscriptionConfig sets the buffer of a subscription and what to do when it
+// is full, dropping its oldest indication by default. With OverflowBlock a full
+// subscriber stops the controller from reading the modem until it catches up,
+// so no other indication is delivered and every pending request times out.
+type SubscriptionConfig struct {
+	BufferSize int
+	Overflow   OverflowPolicy
+}
+
+const defaultSubscriptionBufferSize = 10
+
+type Subscription struct {
+	controller *WiModController
+	codes      map[uint16]bool
+	overflow   OverflowPolicy
+	ch         chan wimod.WiModMessageInd
+	done       chan bool
+	closeOnce  sync.Once
+	mutex      sync.Mutex
+	closed     bool
+	dropped    uint64
+	err        error
+}
+
+// Subscribe delivers every indication with one of the given codes, or every
+// indication if no code is given, until Unsubscribe is called. Those reporting
+// a failure, like an uplink not sent, are delivered too, holding their Status.
+func (c *WiModController) Subscribe(codes ...uint16) *Subscription {
+	return c.SubscribeWithConfig(SubscriptionConfig{}, codes...)
+}
+
+func (c *WiModController) SubscribeWithConfig(config SubscriptionConfig, codes ...uint16) *Subscription {
+	bufferSize := defaultSubscriptionBufferSize
+	if config.BufferSize != 0 {
+		bufferSize = config.BufferSize
+	}
+	s := &Subscription{
+		controller: c,
+		codes:      make(map[uint16]bool),
+		overflow:   config.Overflow,
+		ch:         make(chan wimod.WiModMessageInd, bufferSize),
+		done:       make(chan bool),
+	}
+	for _, code := range codes {
+		s.codes[code] = true
+	}
+	c.mutex.Lock()
+	closed, err := c.closed, c.err
+	if !closed {
+		c.subscriptions = append(c.subscriptions, s)
+	}
+	c.mutex.Unlock()
+	if closed {
+		s.cancel(err)
+	}
+	return s
+}
+
+// C is closed once the subscription is cancelled.
+func (s *Subscription) C() <-chan wimod.WiModMessageInd {
+	return s.ch
+}
+
+// Err returns the error of the controller if it was closed while subscribed.
+func (s *Subscription) Err() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.err
+}
+
+func (s *Subscription) Dropped() uint64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.dropped
+}
+
+func (s *Subscription) Unsubscribe() {
+	s.cancel(nil)
+}
+
+func (s *Subscription) cancel(err error) {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		c := s.controller
+		c.mutex.Lock()
+		for i, sub := range c.subscriptions {
+			if sub == s {
+				c.subscriptions = append(c.subscriptions[:i:i], c.subscriptions[i+1:]...)
+				break
+			}
+		}
+		c.mutex.Unlock()
+		s.mutex.Lock()
+		s.closed = true
+		s.err = err
+		close(s.ch)
+		s.mutex.Unlock()
+	})
+}
+
+func (s *Subscription) matches(code uint16) bool {
+	return len(s.codes) == 0 || s.codes[code]
+}
+
+func (s *Subscription) deliver(event hci.HCIPacket) {
+	ind, err := wimod.DecodeInd(&event)
+	var statusErr *wimod.StatusError
+	if err != nil && !errors.As(err, &statusErr) {
+		s.controller.logger.Warn("discarding undecodable indication", append(packetAttrs(DirectionRx, event), slog.Any("error", err))...)
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return
+	}
+	switch s.overflow {
+	case OverflowDropNewest:
+		select {
+		case s.ch <- ind:
+		default:
+			s.dropped++
+		}
+	case OverflowBlock:
+		select {
+		case s.ch <- ind:
+		case <-s.done:
+		}
+	default:
+		for {
+			select {
+			case s.ch <- ind:
+				return
+			default:
+			}
+			select {
+			case <-s.ch:
+				s.dropped++
+			default:
+			}
+		}
+	}
+}
+
+// publish needs no copy of the subscriptions, as the slice is replaced, never
+// modified in place, when one is removed.
+func (c *WiModController) publish(code uint16, event hci.HCIPacket) {
+	c.mutex.Lock()
+	subscriptions := c.subscriptions
+	for _, watcher := range c.indWatchers {
+		if len(watcher.codes) == 0 || watcher.codes[code] {
+			select {
+			case watcher.channel <- event:
+			default:
+			}
+		}
+	}
+	c.mutex.Unlock()
+	for _, s := range subscriptions {
+		if s.matches(code) {
+			s.deliver(event)
+		}
+	}
+}
+
+type indicationWatcher struct {
+	codes   map[uint16]bool
+	channel chan hci.HCIPacket
+}
+
+// WatchIndications returns the undecoded indications with one of the given
+// codes, or every indication if no code is given, from now on until the
+// returned function is called or the controller is closed. Indications are
+// dropped if the channel, of bufferSize, is full. Their payload is shared and
+// must not be modified.
+func (c *WiModController) WatchIndications(bufferSize int, codes ...uint16) (<-chan hci.HCIPacket, func()) {
+	watcher := indicationWatcher{codes: make(map[uint16]bool), channel: make(chan hci.HCIPacket, bufferSize)}
+	for _, code := range codes {
+		watcher.codes[code] = true
+	}
+	c.mutex.Lock()
+	if c.closed {
+		close(watcher.channel)
+	} else {
+		c.indWatchers = append(c.indWatchers, watcher)
+	}
+	c.mutex.Unlock()
+	return watcher.channel, func() {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		for i, w := range c.indWatchers {
+			if w.channel == watcher.channel {
+				c.indWatchers = append(c.indWatchers[:i:i], c.indWatchers[i+1:]...)
+				close(watcher.channel)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/enolgor/wimod-lorawan-endnode-controller/hci"
+	"github.com/enolgor/wimod-lorawan-endnode-controller/wimod"
+)
+
+type JoinNetworkResult struct {
+	Resp  wimod.JoinNetworkResp
+	TxInd wimod.JoinNetworkTxInd
+	Ind   wimod.JoinNetworkInd
+}
+
+type SendUDataResult struct {
+	Resp  wimod.SendUDataResp
+	TxInd wimod.SendUDataTxInd
+}
+
+// Transaction is TransactionContext bounded by the request timeout plus the
+// indication timeout, the time left to the modem to report the outcome, or
+// only by the request timeout of the response if indications are unbounded.
+func (c *WiModController) Transaction(req wimod.WiModMessageReq, resp wimod.WiModMessageResp, inds ...wimod.WiModMessageInd) error {
+	ctx, cancel := withTimeout(c.transactionTimeout())
+	defer cancel()
+	return c.TransactionContext(ctx, req, resp, inds...)
+}
+
+// TransactionContext sends req and waits for resp and then for each of inds,
+// in order, before ctx is done. The listeners are registered before the
+// request is written so indications sent right after the response are not
+// missed. The response alone is also bounded by the request timeout and
+// other requests may be sent as soon as it arrives. Each indication must have
+// a different code.
+func (c *WiModController) TransactionContext(ctx context.Context, req wimod.WiModMessageReq, resp wimod.WiModMessageResp, inds ...wimod.WiModMessageInd) error {
+	req.Init()
+	resp.Init()
+	return c.intercept(ctx, req, resp, func(ctx context.Context, req wimod.WiModMessageReq, resp wimod.WiModMessageResp) error {
+		latency, err := c.transaction(ctx, req, resp, inds...)
+		c.stats.observeRequest(req.Code(), latency, err)
+		return err
+	})
+}
+
+// transaction returns the time it took to receive the response, if it did.
+func (c *WiModController) transaction(ctx context.Context, req wimod.WiModMessageReq, resp wimod.WiModMessageResp, inds ...wimod.WiModMessageInd) (time.Duration, error) {
+	err := c.queue.acquire(ctx, RequestPriority(req.Code()))
+	if err != nil {
+		return 0, err
+	}
+	released := false
+	release := func() {
+		if !released {
+			released = true
+			c.queue.release()
+		}
+	}
+	defer release()
+	respChannel := make(chan hci.HCIPacket, 1)
+	c.addListener(c.respChannels, resp.Code(), respChannel)
+	defer c.removeListener(c.respChannels, resp.Code(), respChannel)
+	indChannels := make([]chan hci.HCIPacket, len(inds))
+	for i, ind := range inds {
+		ind.Init()
+		indChannels[i] = make(chan hci.HCIPacket, 1)
+		c.addListener(c.eventChannels, ind.Code(), indChannels[i])
+		defer c.removeListener(c.eventChannels, ind.Code(), indChannels[i])
+	}
+	lost, err := c.sendReq(req)
+	if err != nil {
+		return 0, err
+	}
+	sentAt := time.Now()
+	var latency time.Duration
+	respCtx, cancel := withParentTimeout(ctx, c.requestTimeout)
+	defer cancel()
+	select {
+	case hci := <-respChannel:
+		latency = time.Since(sentAt)
+		err = wimod.DecodeResp(&hci, resp)
+		if err != nil {
+			return latency, err
+		}
+		c.trackPowerSaving(req, resp)
+	case <-lost:
+		return latency, c.disconnectedError()
+	case <-c.closing:
+		return latency, c.Err()
+	case <-respCtx.Done():
+		return latency, fmt.Errorf("waiting for response 0x%04X: %w", resp.Code(), respCtx.Err())
+	}
+	release()
+	for i, ind := range inds {
+		select {
+		case hci := <-indChannels[i]:
+			err = wimod.DecodeSpecificInd(&hci, ind)
+			if err != nil {
+				return latency, err
+			}
+		case <-lost:
+			return latency, c.disconnectedError()
+		case <-c.closing:
+			return latency, c.Err()
+		case <-ctx.Done():
+			return latency, fmt.Errorf("waiting for indication 0x%04X: %w", ind.Code(), ctx.Err())
+		}
+	}
+	return latency, nil
+}
+
+func (c *WiModController) transactionTimeout() time.Duration {
+	if c.indTimeout <= 0 || c.requestTimeout <= 0 {
+		return -1
+	}
+	return c.requestTimeout + c.indTimeout
+}
@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/enolgor/wimod-lorawan-endnode-controller/slip"
+	"github.com/enolgor/wimod-lorawan-endnode-controller/wimod"
+)
+
+const (
+	DefaultWakeUpLength        = 40
+	DefaultWakeUpIdleThreshold = 100 * time.Millisecond
+)
+
+type powerSavingMode byte
+
+const (
+	powerSavingUnknown powerSavingMode = iota
+	powerSavingOff
+	powerSavingOn
+)
+
+// wakeUpPreamble returns the SLIP_END bytes to send ahead of a request, none
+// unless automatic power saving is enabled, or not known to be disabled, and
+// nothing was exchanged with the modem for the idle threshold.
+func (c *WiModController) wakeUpPreamble() []byte {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.wakeUpLength <= 0 || c.powerSaving == powerSavingOff {
+		return nil
+	}
+	if !c.lastActivity.IsZero() && time.Since(c.lastActivity) < c.wakeUpIdleThreshold {
+		return nil
+	}
+	return bytes.Repeat([]byte{slip.SLIP_END}, c.wakeUpLength)
+}
+
+func (c *WiModController) touch() {
+	c.mutex.Lock()
+	c.lastActivity = time.Now()
+	c.mutex.Unlock()
+}
+
+// trackPowerSaving follows the automatic power saving setting through the
+// radio stack configuration requests that succeeded.
+func (c *WiModController) trackPowerSaving(req wimod.WiModMessageReq, resp wimod.WiModMessageResp) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	switch req := req.(type) {
+	case *wimod.SetRStackConfigReq:
+		c.powerSaving = powerSavingModeOf(req.AutomaticPowerSaving)
+	case *wimod.ResetReq, *wimod.FactoryResetReq:
+		c.powerSaving = powerSavingUnknown
+	}
+	if resp, ok := resp.(*wimod.GetRStackConfigResp); ok {
+		c.powerSaving = powerSavingModeOf(resp.AutomaticPowerSaving)
+	}
+}
+
+func powerSavingModeOf(enabled bool) powerSavingMode {
+	if enabled {
+		return powerSavingOn
+	}
+	return powerSavingOff
+}
@@ -0,0 +1,150 @@
+package crc
+
+import (
+	"fmt"
+	"hash"
+)
+
+// Params describe a CRC of Width bits, 8 to 64, in the usual Rocksoft model:
+// the register starts at Init, Poly is given in normal, non reflected, form,
+// Reflect reflects both the input bytes and the result and XorOut is applied
+// to the result.
+type Params struct {
+	Width   int
+	Poly    uint64
+	Init    uint64
+	Reflect bool
+	XorOut  uint64
+}
+
+var (
+	// CRC16_HCI is the CRC16 of the HCI packets, also known as CRC-16/X-25.
+	CRC16_HCI = Params{Width: 16, Poly: 0x1021, Init: 0xFFFF, Reflect: true, XorOut: 0xFFFF}
+	// CRC32_IEEE is the CRC32 of Ethernet, zip and the WiMOD firmware images.
+	CRC32_IEEE = Params{Width: 32, Poly: 0x04C11DB7, Init: 0xFFFFFFFF, Reflect: true, XorOut: 0xFFFFFFFF}
+)
+
+// Table holds the lookup table generated for some Params.
+type Table struct {
+	params Params
+	mask   uint64
+	table  [256]uint64
+}
+
+func MakeTable(params Params) (*Table, error) {
+	if params.Width < 8 || params.Width > 64 {
+		return nil, fmt.Errorf("unsupported CRC width %d", params.Width)
+	}
+	t := &Table{params: params, mask: ^uint64(0) >> (64 - params.Width)}
+	if params.Reflect {
+		poly := reflect(params.Poly, params.Width)
+		for i := range t.table {
+			crc := uint64(i)
+			for j := 0; j < 8; j++ {
+				if crc&1 == 1 {
+					crc = (crc >> 1) ^ poly
+				} else {
+					crc >>= 1
+				}
+			}
+			t.table[i] = crc
+		}
+		return t, nil
+	}
+	top := uint64(1) << (params.Width - 1)
+	for i := range t.table {
+		crc := uint64(i) << (params.Width - 8)
+		for j := 0; j < 8; j++ {
+			if crc&top != 0 {
+				crc = (crc << 1) ^ params.Poly
+			} else {
+				crc <<= 1
+			}
+		}
+		t.table[i] = crc & t.mask
+	}
+	return t, nil
+}
+
+func (t *Table) Params() Params {
+	return t.params
+}
+
+// Checksum returns the CRC of data.
+func (t *Table) Checksum(data []byte) uint64 {
+	return t.finish(t.update(t.init(), data))
+}
+
+func (t *Table) init() uint64 {
+	if t.params.Reflect {
+		return reflect(t.params.Init, t.params.Width)
+	}
+	return t.params.Init & t.mask
+}
+
+func (t *Table) update(crc uint64, data []byte) uint64 {
+	if t.params.Reflect {
+		for _, b := range data {
+			crc = (crc >> 8) ^ t.table[byte(crc)^b]
+		}
+		return crc
+	}
+	shift := t.params.Width - 8
+	for _, b := range data {
+		crc = ((crc << 8) ^ t.table[byte(crc>>shift)^b]) & t.mask
+	}
+	return crc
+}
+
+func (t *Table) finish(crc uint64) uint64 {
+	return (crc ^ t.params.XorOut) & t.mask
+}
+
+func reflect(v uint64, width int) uint64 {
+	var r uint64
+	for i := 0; i < width; i++ {
+		r = (r << 1) | (v & 1)
+		v >>= 1
+	}
+	return r
+}
+
+type digest struct {
+	table *Table
+	crc   uint64
+}
+
+// New returns a hash.Hash64 computing the CRC of the table incrementally, Sum
+// appends it in big endian order, in as many bytes as needed for its width.
+func (t *Table) New() hash.Hash64 {
+	return &digest{table: t, crc: t.init()}
+}
+
+func (d *digest) Write(p []byte) (int, error) {
+	d.crc = d.table.update(d.crc, p)
+	return len(p), nil
+}
+
+func (d *digest) Sum64() uint64 {
+	return d.table.finish(d.crc)
+}
+
+func (d *digest) Sum(b []byte) []byte {
+	crc := d.Sum64()
+	for i := d.Size() - 1; i >= 0; i-- {
+		b = append(b, byte(crc>>(8*i)))
+	}
+	return b
+}
+
+func (d *digest) Reset() {
+	d.crc = d.table.init()
+}
+
+func (d *digest) Size() int {
+	return (d.table.params.Width + 7) / 8
+}
+
+func (d *digest) BlockSize() int {
+	return 1
+}
@@ -1,11 +1,17 @@
 package crc
 
+import (
+	"encoding/binary"
+	"hash"
+)
+
 const (
 	crc16_INIT_VALUE = uint16(0xFFFF)
-	crc16_GOOD_VALUE = uint16(0x0F47)
 	crc16_POLYNOM    = 0x8408
 )
 
+const Size16 = 2
+
 var crc16Table = [256]uint16{
 	0x0000, 0x1189, 0x2312, 0x329B, 0x4624, 0x57AD, 0x6536, 0x74BF,
 	0x8C48, 0x9DC1, 0xAF5A, 0xBED3, 0xCA6C, 0xDBE5, 0xE97E, 0xF8F7,
@@ -42,14 +48,63 @@ var crc16Table = [256]uint16{
 }
 
 func CalcCRC16(data []byte) uint16 {
-	len := len(data)
-	crc := uint16(crc16_INIT_VALUE)
-	for i := 0; i < len; i++ {
-		crc = (crc >> 8) ^ crc16Table[(byte(crc)^data[i])&0x00FF]
-	}
-	return ^crc
+	return ^updateCRC16(crc16_INIT_VALUE, data)
 }
 
+// CheckCRC16 reports whether data ends with the CRC of the bytes before it,
+// in little endian order as sent in HCI packets.
 func CheckCRC16(data []byte) bool {
-	return CalcCRC16(data) == crc16_GOOD_VALUE
+	if len(data) < Size16 {
+		return false
+	}
+	n := len(data) - Size16
+	return CalcCRC16(data[:n]) == binary.LittleEndian.Uint16(data[n:])
+}
+
+func updateCRC16(crc uint16, data []byte) uint16 {
+	for _, b := range data {
+		crc = (crc >> 8) ^ crc16Table[byte(crc)^b]
+	}
+	return crc
+}
+
+// Hash16 is the hash.Hash of the HCI CRC16, Sum appends it in big endian
+// order like the hash/crc32 package does.
+type Hash16 interface {
+	hash.Hash
+	Sum16() uint16
+}
+
+type digest16 struct {
+	crc uint16
+}
+
+// New16 returns a Hash16 computing the same CRC as CalcCRC16 incrementally.
+func New16() Hash16 {
+	return &digest16{crc: crc16_INIT_VALUE}
+}
+
+func (d *digest16) Write(p []byte) (int, error) {
+	d.crc = updateCRC16(d.crc, p)
+	return len(p), nil
+}
+
+func (d *digest16) Sum16() uint16 {
+	return ^d.crc
+}
+
+func (d *digest16) Sum(b []byte) []byte {
+	return binary.BigEndian.AppendUint16(b, d.Sum16())
+}
+
+func (d *digest16) Reset() {
+	d.crc = crc16_INIT_VALUE
+}
+
+func (d *digest16) Size() int {
+	return Size16
+}
+
+func (d *digest16) BlockSize() int {
+	return 1
 }
@@ -28,7 +28,12 @@ func (hci *HCIPacket) Encode() []byte {
 	return buff.Bytes()
 }
 
+// Decode does not copy payload, Payload shares its bytes, so payload must not
+// be reused while the packet is in use.
 func (hciPacket *HCIPacket) Decode(payload []byte) error {
+	if len(payload) < 4 {
+		return fmt.Errorf("short HCI packet, expected at least 4 bytes, got %d", len(payload))
+	}
 	if crc.CheckCRC16(payload) {
 		hciPacket.Dst = payload[0]
 		hciPacket.ID = payload[1]
@@ -0,0 +1,541 @@
+package mac
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// LinkCheckReq
+
+type LinkCheckReq struct{}
+
+func (c *LinkCheckReq) CID() byte { return CID_LINK_CHECK }
+func (c *LinkCheckReq) Size() int { return 0 }
+
+func (c *LinkCheckReq) String() string {
+	return "LinkCheckReq[]"
+}
+
+func (c *LinkCheckReq) Encode() []byte {
+	return []byte{}
+}
+
+func (c *LinkCheckReq) Decode(payload []byte) error {
+	return checkSize(c, payload)
+}
+
+// LinkCheckAns
+
+type LinkCheckAns struct {
+	Margin byte
+	GwCnt  byte
+}
+
+func (c *LinkCheckAns) CID() byte { return CID_LINK_CHECK }
+func (c *LinkCheckAns) Size() int { return 2 }
+
+func (c *LinkCheckAns) String() string {
+	return fmt.Sprintf("LinkCheckAns[Margin: %d dB, GwCnt: %d]", c.Margin, c.GwCnt)
+}
+
+func (c *LinkCheckAns) Encode() []byte {
+	return []byte{c.Margin, c.GwCnt}
+}
+
+func (c *LinkCheckAns) Decode(payload []byte) error {
+	if err := checkSize(c, payload); err != nil {
+		return err
+	}
+	c.Margin = payload[0]
+	c.GwCnt = payload[1]
+	return nil
+}
+
+// LinkADRReq
+
+type LinkADRReq struct {
+	DataRate   byte
+	TXPower    byte
+	ChMask     uint16
+	ChMaskCntl byte
+	NbTrans    byte
+}
+
+func (c *LinkADRReq) CID() byte { return CID_LINK_ADR }
+func (c *LinkADRReq) Size() int { return 4 }
+
+func (c *LinkADRReq) String() string {
+	return fmt.Sprintf("LinkADRReq[DataRate: %d, TXPower: %d, ChMask: 0x%04X, ChMaskCntl: %d, NbTrans: %d]", c.DataRate, c.TXPower, c.ChMask, c.ChMaskCntl, c.NbTrans)
+}
+
+func (c *LinkADRReq) Encode() []byte {
+	payload := make([]byte, 4)
+	payload[0] = (c.DataRate&0x0F)<<4 | c.TXPower&0x0F
+	binary.LittleEndian.PutUint16(payload[1:3], c.ChMask)
+	payload[3] = (c.ChMaskCntl&0x07)<<4 | c.NbTrans&0x0F
+	return payload
+}
+
+func (c *LinkADRReq) Decode(payload []byte) error {
+	if err := checkSize(c, payload); err != nil {
+		return err
+	}
+	c.DataRate = payload[0] >> 4
+	c.TXPower = payload[0] & 0x0F
+	c.ChMask = binary.LittleEndian.Uint16(payload[1:3])
+	c.ChMaskCntl = (payload[3] >> 4) & 0x07
+	c.NbTrans = payload[3] & 0x0F
+	return nil
+}
+
+// LinkADRAns
+
+type LinkADRAns struct {
+	PowerACK       bool
+	DataRateACK    bool
+	ChannelMaskACK bool
+}
+
+func (c *LinkADRAns) CID() byte { return CID_LINK_ADR }
+func (c *LinkADRAns) Size() int { return 1 }
+
+func (c *LinkADRAns) String() string {
+	return fmt.Sprintf("LinkADRAns[PowerACK: %t, DataRateACK: %t, ChannelMaskACK: %t]", c.PowerACK, c.DataRateACK, c.ChannelMaskACK)
+}
+
+func (c *LinkADRAns) Encode() []byte {
+	return []byte{encodeBits(c.ChannelMaskACK, c.DataRateACK, c.PowerACK)}
+}
+
+func (c *LinkADRAns) Decode(payload []byte) error {
+	if err := checkSize(c, payload); err != nil {
+		return err
+	}
+	c.ChannelMaskACK = payload[0]&0x01 != 0
+	c.DataRateACK = payload[0]&0x02 != 0
+	c.PowerACK = payload[0]&0x04 != 0
+	return nil
+}
+
+// DutyCycleReq
+
+type DutyCycleReq struct {
+	MaxDCycle byte
+}
+
+func (c *DutyCycleReq) CID() byte { return CID_DUTY_CYCLE }
+func (c *DutyCycleReq) Size() int { return 1 }
+
+func (c *DutyCycleReq) String() string {
+	return fmt.Sprintf("DutyCycleReq[MaxDCycle: %d]", c.MaxDCycle)
+}
+
+func (c *DutyCycleReq) Encode() []byte {
+	return []byte{c.MaxDCycle & 0x0F}
+}
+
+func (c *DutyCycleReq) Decode(payload []byte) error {
+	if err := checkSize(c, payload); err != nil {
+		return err
+	}
+	c.MaxDCycle = payload[0] & 0x0F
+	return nil
+}
+
+// DutyCycleAns
+
+type DutyCycleAns struct{}
+
+func (c *DutyCycleAns) CID() byte { return CID_DUTY_CYCLE }
+func (c *DutyCycleAns) Size() int { return 0 }
+
+func (c *DutyCycleAns) String() string {
+	return "DutyCycleAns[]"
+}
+
+func (c *DutyCycleAns) Encode() []byte {
+	return []byte{}
+}
+
+func (c *DutyCycleAns) Decode(payload []byte) error {
+	return checkSize(c, payload)
+}
+
+// RXParamSetupReq
+
+type RXParamSetupReq struct {
+	RX1DROffset byte
+	RX2DataRate byte
+	Frequency   uint32
+}
+
+func (c *RXParamSetupReq) CID() byte { return CID_RX_PARAM_SETUP }
+func (c *RXParamSetupReq) Size() int { return 4 }
+
+func (c *RXParamSetupReq) String() string {
+	return fmt.Sprintf("RXParamSetupReq[RX1DROffset: %d, RX2DataRate: %d, Frequency: %d Hz]", c.RX1DROffset, c.RX2DataRate, c.Frequency)
+}
+
+func (c *RXParamSetupReq) Encode() []byte {
+	return append([]byte{(c.RX1DROffset&0x07)<<4 | c.RX2DataRate&0x0F}, encodeFrequency(c.Frequency)...)
+}
+
+func (c *RXParamSetupReq) Decode(payload []byte) error {
+	if err := checkSize(c, payload); err != nil {
+		return err
+	}
+	c.RX1DROffset = (payload[0] >> 4) & 0x07
+	c.RX2DataRate = payload[0] & 0x0F
+	c.Frequency = decodeFrequency(payload[1:4])
+	return nil
+}
+
+// RXParamSetupAns
+
+type RXParamSetupAns struct {
+	RX1DROffsetACK bool
+	RX2DataRateACK bool
+	ChannelACK     bool
+}
+
+func (c *RXParamSetupAns) CID() byte { return CID_RX_PARAM_SETUP }
+func (c *RXParamSetupAns) Size() int { return 1 }
+
+func (c *RXParamSetupAns) String() string {
+	return fmt.Sprintf("RXParamSetupAns[RX1DROffsetACK: %t, RX2DataRateACK: %t, ChannelACK: %t]", c.RX1DROffsetACK, c.RX2DataRateACK, c.ChannelACK)
+}
+
+func (c *RXParamSetupAns) Encode() []byte {
+	return []byte{encodeBits(c.ChannelACK, c.RX2DataRateACK, c.RX1DROffsetACK)}
+}
+
+func (c *RXParamSetupAns) Decode(payload []byte) error {
+	if err := checkSize(c, payload); err != nil {
+		return err
+	}
+	c.ChannelACK = payload[0]&0x01 != 0
+	c.RX2DataRateACK = payload[0]&0x02 != 0
+	c.RX1DROffsetACK = payload[0]&0x04 != 0
+	return nil
+}
+
+// DevStatusReq
+
+type DevStatusReq struct{}
+
+func (c *DevStatusReq) CID() byte { return CID_DEV_STATUS }
+func (c *DevStatusReq) Size() int { return 0 }
+
+func (c *DevStatusReq) String() string {
+	return "DevStatusReq[]"
+}
+
+func (c *DevStatusReq) Encode() []byte {
+	return []byte{}
+}
+
+func (c *DevStatusReq) Decode(payload []byte) error {
+	return checkSize(c, payload)
+}
+
+// DevStatusAns
+
+type DevStatusAns struct {
+	Battery byte
+	Margin  int8
+}
+
+func (c *DevStatusAns) CID() byte { return CID_DEV_STATUS }
+func (c *DevStatusAns) Size() int { return 2 }
+
+func (c *DevStatusAns) String() string {
+	return fmt.Sprintf("DevStatusAns[Battery: %d, Margin: %d dB]", c.Battery, c.Margin)
+}
+
+func (c *DevStatusAns) Encode() []byte {
+	return []byte{c.Battery, byte(c.Margin) & 0x3F}
+}
+
+func (c *DevStatusAns) Decode(payload []byte) error {
+	if err := checkSize(c, payload); err != nil {
+		return err
+	}
+	c.Battery = payload[0]
+	c.Margin = int8(payload[1]<<2) >> 2
+	return nil
+}
+
+// NewChannelReq
+
+type NewChannelReq struct {
+	ChIndex   byte
+	Frequency uint32
+	MinDR     byte
+	MaxDR     byte
+}
+
+func (c *NewChannelReq) CID() byte { return CID_NEW_CHANNEL }
+func (c *NewChannelReq) Size() int { return 5 }
+
+func (c *NewChannelReq) String() string {
+	return fmt.Sprintf("NewChannelReq[ChIndex: %d, Frequency: %d Hz, MinDR: %d, MaxDR: %d]", c.ChIndex, c.Frequency, c.MinDR, c.MaxDR)
+}
+
+func (c *NewChannelReq) Encode() []byte {
+	payload := append([]byte{c.ChIndex}, encodeFrequency(c.Frequency)...)
+	return append(payload, (c.MaxDR&0x0F)<<4|c.MinDR&0x0F)
+}
+
+func (c *NewChannelReq) Decode(payload []byte) error {
+	if err := checkSize(c, payload); err != nil {
+		return err
+	}
+	c.ChIndex = payload[0]
+	c.Frequency = decodeFrequency(payload[1:4])
+	c.MaxDR = payload[4] >> 4
+	c.MinDR = payload[4] & 0x0F
+	return nil
+}
+
+// NewChannelAns
+
+type NewChannelAns struct {
+	DataRateRangeOK    bool
+	ChannelFrequencyOK bool
+}
+
+func (c *NewChannelAns) CID() byte { return CID_NEW_CHANNEL }
+func (c *NewChannelAns) Size() int { return 1 }
+
+func (c *NewChannelAns) String() string {
+	return fmt.Sprintf("NewChannelAns[DataRateRangeOK: %t, ChannelFrequencyOK: %t]", c.DataRateRangeOK, c.ChannelFrequencyOK)
+}
+
+func (c *NewChannelAns) Encode() []byte {
+	return []byte{encodeBits(c.ChannelFrequencyOK, c.DataRateRangeOK)}
+}
+
+func (c *NewChannelAns) Decode(payload []byte) error {
+	if err := checkSize(c, payload); err != nil {
+		return err
+	}
+	c.ChannelFrequencyOK = payload[0]&0x01 != 0
+	c.DataRateRangeOK = payload[0]&0x02 != 0
+	return nil
+}
+
+// RXTimingSetupReq
+
+type RXTimingSetupReq struct {
+	Delay byte
+}
+
+func (c *RXTimingSetupReq) CID() byte { return CID_RX_TIMING }
+func (c *RXTimingSetupReq) Size() int { return 1 }
+
+func (c *RXTimingSetupReq) String() string {
+	return fmt.Sprintf("RXTimingSetupReq[Delay: %d]", c.Delay)
+}
+
+func (c *RXTimingSetupReq) Encode() []byte {
+	return []byte{c.Delay & 0x0F}
+}
+
+func (c *RXTimingSetupReq) Decode(payload []byte) error {
+	if err := checkSize(c, payload); err != nil {
+		return err
+	}
+	c.Delay = payload[0] & 0x0F
+	return nil
+}
+
+// RXTimingSetupAns
+
+type RXTimingSetupAns struct{}
+
+func (c *RXTimingSetupAns) CID() byte { return CID_RX_TIMING }
+func (c *RXTimingSetupAns) Size() int { return 0 }
+
+func (c *RXTimingSetupAns) String() string {
+	return "RXTimingSetupAns[]"
+}
+
+func (c *RXTimingSetupAns) Encode() []byte {
+	return []byte{}
+}
+
+func (c *RXTimingSetupAns) Decode(payload []byte) error {
+	return checkSize(c, payload)
+}
+
+// TXParamSetupReq
+
+type TXParamSetupReq struct {
+	DownlinkDwellTime bool
+	UplinkDwellTime   bool
+	MaxEIRP           byte
+}
+
+func (c *TXParamSetupReq) CID() byte { return CID_TX_PARAM_SETUP }
+func (c *TXParamSetupReq) Size() int { return 1 }
+
+func (c *TXParamSetupReq) String() string {
+	return fmt.Sprintf("TXParamSetupReq[DownlinkDwellTime: %t, UplinkDwellTime: %t, MaxEIRP: %d]", c.DownlinkDwellTime, c.UplinkDwellTime, c.MaxEIRP)
+}
+
+func (c *TXParamSetupReq) Encode() []byte {
+	return []byte{encodeBits(false, false, false, false, c.UplinkDwellTime, c.DownlinkDwellTime) | c.MaxEIRP&0x0F}
+}
+
+func (c *TXParamSetupReq) Decode(payload []byte) error {
+	if err := checkSize(c, payload); err != nil {
+		return err
+	}
+	c.DownlinkDwellTime = payload[0]&0x20 != 0
+	c.UplinkDwellTime = payload[0]&0x10 != 0
+	c.MaxEIRP = payload[0] & 0x0F
+	return nil
+}
+
+// TXParamSetupAns
+
+type TXParamSetupAns struct{}
+
+func (c *TXParamSetupAns) CID() byte { return CID_TX_PARAM_SETUP }
+func (c *TXParamSetupAns) Size() int { return 0 }
+
+func (c *TXParamSetupAns) String() string {
+	return "TXParamSetupAns[]"
+}
+
+func (c *TXParamSetupAns) Encode() []byte {
+	return []byte{}
+}
+
+func (c *TXParamSetupAns) Decode(payload []byte) error {
+	return checkSize(c, payload)
+}
+
+// DlChannelReq
+
+type DlChannelReq struct {
+	ChIndex   byte
+	Frequency uint32
+}
+
+func (c *DlChannelReq) CID() byte { return CID_DL_CHANNEL }
+func (c *DlChannelReq) Size() int { return 4 }
+
+func (c *DlChannelReq) String() string {
+	return fmt.Sprintf("DlChannelReq[ChIndex: %d, Frequency: %d Hz]", c.ChIndex, c.Frequency)
+}
+
+func (c *DlChannelReq) Encode() []byte {
+	return append([]byte{c.ChIndex}, encodeFrequency(c.Frequency)...)
+}
+
+func (c *DlChannelReq) Decode(payload []byte) error {
+	if err := checkSize(c, payload); err != nil {
+		return err
+	}
+	c.ChIndex = payload[0]
+	c.Frequency = decodeFrequency(payload[1:4])
+	return nil
+}
+
+// DlChannelAns
+
+type DlChannelAns struct {
+	UplinkFrequencyExists bool
+	ChannelFrequencyOK    bool
+}
+
+func (c *DlChannelAns) CID() byte { return CID_DL_CHANNEL }
+func (c *DlChannelAns) Size() int { return 1 }
+
+func (c *DlChannelAns) String() string {
+	return fmt.Sprintf("DlChannelAns[UplinkFrequencyExists: %t, ChannelFrequencyOK: %t]", c.UplinkFrequencyExists, c.ChannelFrequencyOK)
+}
+
+func (c *DlChannelAns) Encode() []byte {
+	return []byte{encodeBits(c.ChannelFrequencyOK, c.UplinkFrequencyExists)}
+}
+
+func (c *DlChannelAns) Decode(payload []byte) error {
+	if err := checkSize(c, payload); err != nil {
+		return err
+	}
+	c.ChannelFrequencyOK = payload[0]&0x01 != 0
+	c.UplinkFrequencyExists = payload[0]&0x02 != 0
+	return nil
+}
+
+// DeviceTimeReq
+
+type DeviceTimeReq struct{}
+
+func (c *DeviceTimeReq) CID() byte { return CID_DEVICE_TIME }
+func (c *DeviceTimeReq) Size() int { return 0 }
+
+func (c *DeviceTimeReq) String() string {
+	return "DeviceTimeReq[]"
+}
+
+func (c *DeviceTimeReq) Encode() []byte {
+	return []byte{}
+}
+
+func (c *DeviceTimeReq) Decode(payload []byte) error {
+	return checkSize(c, payload)
+}
+
+// DeviceTimeAns
+
+var gpsEpoch = time.Date(1980, time.January, 6, 0, 0, 0, 0, time.UTC)
+
+// GPS time is ahead of UTC by the leap seconds inserted since the GPS epoch.
+const gpsLeapSeconds = 18
+
+type DeviceTimeAns struct {
+	Seconds  uint32
+	Fraction byte
+}
+
+func (c *DeviceTimeAns) CID() byte { return CID_DEVICE_TIME }
+func (c *DeviceTimeAns) Size() int { return 5 }
+
+func (c *DeviceTimeAns) String() string {
+	return fmt.Sprintf("DeviceTimeAns[Seconds: %d, Fraction: %d, Time: %s]", c.Seconds, c.Fraction, c.Time())
+}
+
+func (c *DeviceTimeAns) Time() time.Time {
+	fraction := time.Duration(c.Fraction) * time.Second / 256
+	return gpsEpoch.Add(time.Duration(int64(c.Seconds)-gpsLeapSeconds)*time.Second + fraction)
+}
+
+func (c *DeviceTimeAns) Encode() []byte {
+	payload := make([]byte, 5)
+	binary.LittleEndian.PutUint32(payload[0:4], c.Seconds)
+	payload[4] = c.Fraction
+	return payload
+}
+
+func (c *DeviceTimeAns) Decode(payload []byte) error {
+	if err := checkSize(c, payload); err != nil {
+		return err
+	}
+	c.Seconds = binary.LittleEndian.Uint32(payload[0:4])
+	c.Fraction = payload[4]
+	return nil
+}
+
+func encodeBits(bits ...bool) byte {
+	b := byte(0)
+	for i, bit := range bits {
+		if bit {
+			b |= 1 << uint(i)
+		}
+	}
+	return b
+}
@@ -0,0 +1,107 @@
+package mac
+
+import (
+	"fmt"
+)
+
+const (
+	CID_LINK_CHECK     byte = 0x02
+	CID_LINK_ADR       byte = 0x03
+	CID_DUTY_CYCLE     byte = 0x04
+	CID_RX_PARAM_SETUP byte = 0x05
+	CID_DEV_STATUS     byte = 0x06
+	CID_NEW_CHANNEL    byte = 0x07
+	CID_RX_TIMING      byte = 0x08
+	CID_TX_PARAM_SETUP byte = 0x09
+	CID_DL_CHANNEL     byte = 0x0A
+	CID_DEVICE_TIME    byte = 0x0D
+)
+
+type Command interface {
+	CID() byte
+	Size() int
+	Encode() []byte
+	Decode(payload []byte) error
+	String() string
+}
+
+var uplinkConstructors = map[byte]func() Command{
+	CID_LINK_CHECK:     func() Command { return &LinkCheckReq{} },
+	CID_LINK_ADR:       func() Command { return &LinkADRAns{} },
+	CID_DUTY_CYCLE:     func() Command { return &DutyCycleAns{} },
+	CID_RX_PARAM_SETUP: func() Command { return &RXParamSetupAns{} },
+	CID_DEV_STATUS:     func() Command { return &DevStatusAns{} },
+	CID_NEW_CHANNEL:    func() Command { return &NewChannelAns{} },
+	CID_RX_TIMING:      func() Command { return &RXTimingSetupAns{} },
+	CID_TX_PARAM_SETUP: func() Command { return &TXParamSetupAns{} },
+	CID_DL_CHANNEL:     func() Command { return &DlChannelAns{} },
+	CID_DEVICE_TIME:    func() Command { return &DeviceTimeReq{} },
+}
+
+var downlinkConstructors = map[byte]func() Command{
+	CID_LINK_CHECK:     func() Command { return &LinkCheckAns{} },
+	CID_LINK_ADR:       func() Command { return &LinkADRReq{} },
+	CID_DUTY_CYCLE:     func() Command { return &DutyCycleReq{} },
+	CID_RX_PARAM_SETUP: func() Command { return &RXParamSetupReq{} },
+	CID_DEV_STATUS:     func() Command { return &DevStatusReq{} },
+	CID_NEW_CHANNEL:    func() Command { return &NewChannelReq{} },
+	CID_RX_TIMING:      func() Command { return &RXTimingSetupReq{} },
+	CID_TX_PARAM_SETUP: func() Command { return &TXParamSetupReq{} },
+	CID_DL_CHANNEL:     func() Command { return &DlChannelReq{} },
+	CID_DEVICE_TIME:    func() Command { return &DeviceTimeAns{} },
+}
+
+func DecodeUplink(list []byte) ([]Command, error) {
+	return decodeList(list, uplinkConstructors)
+}
+
+func DecodeDownlink(list []byte) ([]Command, error) {
+	return decodeList(list, downlinkConstructors)
+}
+
+func decodeList(list []byte, constructors map[byte]func() Command) ([]Command, error) {
+	cmds := []Command{}
+	for i := 0; i < len(list); {
+		constructor, ok := constructors[list[i]]
+		if !ok {
+			return cmds, fmt.Errorf("unknown MAC command CID 0x%02X at offset %d", list[i], i)
+		}
+		cmd := constructor()
+		start := i + 1
+		end := start + cmd.Size()
+		if end > len(list) {
+			return cmds, fmt.Errorf("MAC command CID 0x%02X truncated: expected %d bytes, got %d", list[i], cmd.Size(), len(list)-start)
+		}
+		if err := cmd.Decode(list[start:end]); err != nil {
+			return cmds, err
+		}
+		cmds = append(cmds, cmd)
+		i = end
+	}
+	return cmds, nil
+}
+
+func Encode(cmds ...Command) []byte {
+	list := []byte{}
+	for _, cmd := range cmds {
+		list = append(list, cmd.CID())
+		list = append(list, cmd.Encode()...)
+	}
+	return list
+}
+
+func checkSize(cmd Command, payload []byte) error {
+	if len(payload) != cmd.Size() {
+		return fmt.Errorf("MAC command CID 0x%02X: expected %d bytes, got %d", cmd.CID(), cmd.Size(), len(payload))
+	}
+	return nil
+}
+
+func encodeFrequency(freq uint32) []byte {
+	value := freq / 100
+	return []byte{byte(value), byte(value >> 8), byte(value >> 16)}
+}
+
+func decodeFrequency(bytes []byte) uint32 {
+	return (uint32(bytes[0]) | uint32(bytes[1])<<8 | uint32(bytes[2])<<16) * 100
+}
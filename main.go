@@ -1,31 +1,47 @@
 package main
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/hex"
+	"errors"
+	"expvar"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"net/rpc"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 	"text/tabwriter"
 	"time"
 
 	"github.com/enolgor/wimod-lorawan-endnode-controller/controller"
+	"github.com/enolgor/wimod-lorawan-endnode-controller/hci"
+	"github.com/enolgor/wimod-lorawan-endnode-controller/mac"
+	"github.com/enolgor/wimod-lorawan-endnode-controller/region"
 	"github.com/enolgor/wimod-lorawan-endnode-controller/rpc/client"
 	"github.com/enolgor/wimod-lorawan-endnode-controller/rpc/server"
 	"github.com/enolgor/wimod-lorawan-endnode-controller/wimod"
 	"github.com/tarm/serial"
 )
 
-// controller info -network -firmware -device -radio
+// controller info -network -firmware -device -radio -bands
 // controller join -type otaa|abp -appkey asdf -nwkskey asdf -appskey asdf -eui asdf
 // controller send -enc ascii|hex|b64 -type u|c asdfasdf -port 1
 // controller synctime
+// controller listen -enc ascii|hex|b64
+// controller linkcheck -type u|c
 // controller deactivate
+// controller config radio -datarate 5 -adr=false
+// controller config custom -rfgain -3
+// controller config linkadr -option semtech
+// controller provision -csv devices.csv -serialports COM3,COM4 -report report.csv
 
 const usageMessage = `
 Usage: loractl <command> [<args>]
@@ -35,14 +51,26 @@ Available commands:
   info        Display information about the network/device
   join        Join a LoRa network
   send        Send a packet to the network
+  listen      Print downlink packets and RX outcomes as they arrive
+  linkcheck   Request a link check from the network and print the answer
   synctime    Synchronize time with the host machine
   deactivate  Deactivate device
+  config      Read or modify device configuration
+  provision   Factory reset and program attached devices from a CSV file
+
+Exit status is 0 on success, 1 on a local error and, if the device answered
+with an error status, 11 error, 12 not supported, 13 wrong parameter, 14
+wrong device mode, 15 not activated, 16 busy, 17 queue full, 18 length error,
+19 no factory settings, 20 channel blocked, 21 channel not available or 10
+any other.
 `
 
 var serverCommand = flag.NewFlagSet("server", flag.ExitOnError)
 var infoCommand = flag.NewFlagSet("info", flag.ExitOnError)
 var joinCommand = flag.NewFlagSet("join", flag.ExitOnError)
 var sendCommand = flag.NewFlagSet("send", flag.ExitOnError)
+var listenCommand = flag.NewFlagSet("listen", flag.ExitOnError)
+var linkcheckCommand = flag.NewFlagSet("linkcheck", flag.ExitOnError)
 var synctimeCommand = flag.NewFlagSet("synctime", flag.ExitOnError)
 var deactivateCommand = flag.NewFlagSet("deactivate", flag.ExitOnError)
 
@@ -70,6 +98,22 @@ const (
 	serverBindPortUsage       = "Specify port to bind the server"
 )
 
+var serverLogLevel string
+
+const (
+	serverLogLevelFlag        = "loglevel"
+	defaultServerLogLevelFlag = "info"
+	serverLogLevelUsage       = "Specify controller log level: debug|info|warn|error"
+)
+
+var serverTrace bool
+
+const (
+	serverTraceFlag        = "trace"
+	defaultServerTraceFlag = false
+	serverTraceUsage       = "Log every hci packet sent or received"
+)
+
 var serverHost string
 
 const (
@@ -118,6 +162,14 @@ const (
 	infoRadioUsage       = "Display radio information"
 )
 
+var infoBands bool
+
+const (
+	infoBandsFlag        = "bands"
+	defaultInfoBandsFlag = false
+	infoBandsUsage       = "Display bands supported by the firmware"
+)
+
 var joinType string
 
 const (
@@ -198,10 +250,28 @@ const (
 	sendPortUsage       = "Specify port: 0-255"
 )
 
+var listenEnc string
+
+const (
+	listenEncFlag        = "enc"
+	defaultListenEncFlag = "hex"
+	listenEncUsage       = "Specify encoding of printed payload: ascii|hex|b64"
+)
+
+var linkcheckType string
+
+const (
+	linkcheckTypeFlag        = "type"
+	defaultLinkcheckTypeFlag = "u"
+	linkcheckTypeUsage       = "Specify type of the uplink carrying the request: c|u"
+)
+
 func init() {
 	serverCommand.StringVar(&serialPort, serialPortFlag, defaultSerialPortFlag, serialPortUsage)
 	serverCommand.StringVar(&serverBindIP, serverBindIPFlag, defaultServerBindIPFlag, serverBindIPUsage)
 	serverCommand.UintVar(&serverBindPort, serverBindPortFlag, defaultServerBindPortFlag, serverBindPortUsage)
+	serverCommand.StringVar(&serverLogLevel, serverLogLevelFlag, defaultServerLogLevelFlag, serverLogLevelUsage)
+	serverCommand.BoolVar(&serverTrace, serverTraceFlag, defaultServerTraceFlag, serverTraceUsage)
 
 	infoCommand.StringVar(&serverHost, serverHostFlag, defaultServerHostFlag, serverHostUsage)
 	infoCommand.BoolVar(&infoNetwork, infoNetworkFlag, defaultInfoNetworkFlag, infoNetworkUsage)
@@ -209,6 +279,7 @@ func init() {
 	infoCommand.BoolVar(&infoDevice, infoDeviceFlag, defaultInfoDeviceFlag, infoDeviceUsage)
 	infoCommand.BoolVar(&infoStatus, infoStatusFlag, defaultInfoStatusFlag, infoStatusUsage)
 	infoCommand.BoolVar(&infoRadio, infoRadioFlag, defaultInfoRadioFlag, infoRadioUsage)
+	infoCommand.BoolVar(&infoBands, infoBandsFlag, defaultInfoBandsFlag, infoBandsUsage)
 
 	joinCommand.StringVar(&serverHost, serverHostFlag, defaultServerHostFlag, serverHostUsage)
 	joinCommand.StringVar(&joinType, joinTypeFlag, defaultJoinTypeFlag, joinTypeUsage)
@@ -224,6 +295,12 @@ func init() {
 	sendCommand.StringVar(&sendPayload, sendPayloadFlag, defaultSendPayloadFlag, sendPayloadUsage)
 	sendCommand.UintVar(&sendPort, sendPortFlag, defaultSendPortFlag, sendPortUsage)
 
+	listenCommand.StringVar(&serverHost, serverHostFlag, defaultServerHostFlag, serverHostUsage)
+	listenCommand.StringVar(&listenEnc, listenEncFlag, defaultListenEncFlag, listenEncUsage)
+
+	linkcheckCommand.StringVar(&serverHost, serverHostFlag, defaultServerHostFlag, serverHostUsage)
+	linkcheckCommand.StringVar(&linkcheckType, linkcheckTypeFlag, defaultLinkcheckTypeFlag, linkcheckTypeUsage)
+
 	deactivateCommand.StringVar(&serverHost, serverHostFlag, defaultServerHostFlag, serverHostUsage)
 
 	synctimeCommand.StringVar(&serverHost, serverHostFlag, defaultServerHostFlag, serverHostUsage)
@@ -248,12 +325,23 @@ func main() {
 	case "send":
 		sendCommand.Parse(os.Args[2:])
 		runSendCommand()
+	case "listen":
+		listenCommand.Parse(os.Args[2:])
+		runListenCommand()
+	case "linkcheck":
+		linkcheckCommand.Parse(os.Args[2:])
+		runLinkcheckCommand()
 	case "synctime":
 		synctimeCommand.Parse(os.Args[2:])
 		runSynctimeCommand()
 	case "deactivate":
 		deactivateCommand.Parse(os.Args[2:])
 		runDeactivateCommand()
+	case "config":
+		runConfigCommand(os.Args[2:])
+	case "provision":
+		provisionCommand.Parse(os.Args[2:])
+		runProvisionCommand()
 	default:
 		fmt.Fprintf(os.Stderr, "%q is not a valid command\n", os.Args[1])
 		fmt.Fprint(os.Stderr, usageMessage)
@@ -268,21 +356,74 @@ func printDefaults(flagSet *flag.FlagSet) {
 
 func printErrorAndExit(e error) {
 	fmt.Fprintf(os.Stderr, "ERROR: %s\n", e.Error())
-	os.Exit(1)
+	os.Exit(exitCode(e))
+}
+
+const exitStatusError = 10
+
+var statusExitCodes = []struct {
+	err  error
+	code int
+}{
+	{wimod.ErrDevMgmtError, 11},
+	{wimod.ErrLoRaWANError, 11},
+	{wimod.ErrDevMgmtCmdNotSupported, 12},
+	{wimod.ErrLoRaWANCmdNotSupported, 12},
+	{wimod.ErrDevMgmtWrongParameter, 13},
+	{wimod.ErrLoRaWANWrongParameter, 13},
+	{wimod.ErrWrongDeviceMode, 14},
+	{wimod.ErrDeviceNotActivated, 15},
+	{wimod.ErrDeviceBusy, 16},
+	{wimod.ErrQueueFull, 17},
+	{wimod.ErrLengthError, 18},
+	{wimod.ErrNoFactorySettings, 19},
+	{wimod.ErrChannelBlocked, 20},
+	{wimod.ErrChannelNotAvailable, 21},
+}
+
+func exitCode(e error) int {
+	var statusErr *wimod.StatusError
+	if !errors.As(e, &statusErr) {
+		return 1
+	}
+	for _, s := range statusExitCodes {
+		if errors.Is(statusErr, s.err) {
+			return s.code
+		}
+	}
+	return exitStatusError
 }
 
 func getTabWriter() *tabwriter.Writer {
 	return tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
 }
 
+var controllerLogger *slog.Logger
+var controllerTrace controller.TraceFunc
+
 func getController() *controller.WiModController {
-	c := &serial.Config{Name: serialPort, Baud: 115200, Size: 8, Parity: serial.ParityNone, StopBits: 1}
-	s, err := serial.OpenPort(c)
+	controller, err := openController(serialPort)
 	if err != nil {
 		printErrorAndExit(err)
 	}
-	config := &controller.WiModControllerConfig{Stream: s}
-	return controller.NewController(config)
+	return controller
+}
+
+func openController(port string) (*controller.WiModController, error) {
+	s, err := openSerialPort(port)
+	if err != nil {
+		return nil, err
+	}
+	dial := func() (io.ReadWriteCloser, error) {
+		return openSerialPort(port)
+	}
+	config := &controller.WiModControllerConfig{Stream: s, Dial: dial, Logger: controllerLogger, Trace: controllerTrace, IndicationTimeout: controller.DefaultIndicationTimeout}
+	return controller.NewController(config), nil
+}
+
+func openSerialPort(port string) (io.ReadWriteCloser, error) {
+	c := &serial.Config{Name: port, Baud: 115200, Size: 8, Parity: serial.ParityNone, StopBits: 1}
+	return serial.OpenPort(c)
 }
 
 func getClient() *client.WimodClient {
@@ -293,26 +434,39 @@ func getClient() *client.WimodClient {
 	return &client.WimodClient{Client: cli}
 }
 
-func dataRateString(idx byte) string {
-	switch idx {
-	case 0:
-		return "LoRa SF12, 125kHz, 250bps"
-	case 1:
-		return "LoRa SF11, 125kHz, 440bps"
-	case 2:
-		return "LoRa SF10, 125kHz, 980bps"
-	case 3:
-		return "LoRa SF9, 125kHz, 1760bps"
-	case 4:
-		return "LoRa SF8, 125kHz, 3125bps"
-	case 5:
-		return "LoRa SF7, 125kHz, 5470bps"
-	case 6:
-		return "LoRa SF7, 250kHz, 11000bps"
-	case 7:
-		return "FSK 50K, -, 50000bps"
-	}
-	return "Unknown Data Rate"
+func moduleTypeString(moduleType byte) string {
+	switch moduleType {
+	case 0x90:
+		return "iM880A"
+	case 0x92:
+		return "iM880A-L"
+	case 0x93:
+		return "iU880A"
+	case 0x98:
+		return "iM880B-L"
+	case 0x99:
+		return "iU880B"
+	case 0x9A:
+		return "iM980A"
+	case 0xA0:
+		return "iM881A"
+	}
+	return "Unknown"
+}
+
+func lookupBand(bandIdx byte) *region.Band {
+	if band, ok := region.Lookup(bandIdx); ok {
+		return band
+	}
+	return &region.Band{Index: bandIdx, Name: region.Name(bandIdx)}
+}
+
+func getBand(client *client.WimodClient) *region.Band {
+	resp, err := client.GetRStackConfig()
+	if err != nil {
+		printErrorAndExit(err)
+	}
+	return lookupBand(resp.BandIdx)
 }
 
 func runServerCommand() {
@@ -321,18 +475,42 @@ func runServerCommand() {
 		printDefaults(serverCommand)
 		os.Exit(1)
 	}
+	var level slog.Level
+	err := level.UnmarshalText([]byte(serverLogLevel))
+	if err != nil {
+		printErrorAndExit(fmt.Errorf("log level should be debug, info, warn or error"))
+	}
+	controllerLogger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+	if serverTrace {
+		controllerTrace = func(direction controller.Direction, packet hci.HCIPacket) {
+			controllerLogger.Info("trace", slog.String("direction", direction.String()), slog.String("packet", packet.String()))
+		}
+	}
 	server := server.WimodServer{Controller: getController()}
+	expvar.Publish("controller", expvar.Func(func() any {
+		return server.Controller.Stats()
+	}))
 	rpc.Register(&server)
 	rpc.HandleHTTP()
 	l, e := net.Listen("tcp", fmt.Sprintf("%s:%d", serverBindIP, serverBindPort))
 	if e != nil {
 		log.Fatal("listen error:", e)
 	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		err := server.Controller.Run(ctx)
+		if err != nil && err != controller.ErrClosed {
+			log.Println(err)
+		}
+		l.Close()
+	}()
 	http.Serve(l, nil)
+	<-server.Controller.Done()
 }
 
 func runInfoCommand() {
-	if !infoNetwork && !infoFirmware && !infoDevice && !infoStatus && !infoRadio {
+	if !infoNetwork && !infoFirmware && !infoDevice && !infoStatus && !infoRadio && !infoBands {
 		printDefaults(infoCommand)
 		os.Exit(1)
 	}
@@ -357,7 +535,9 @@ func runInfoCommand() {
 		fmt.Fprint(w, "\nNETWORK INFO:\n\n")
 		fmt.Fprintf(w, "Network Status:\t%s\n", statusStr)
 		fmt.Fprintf(w, "Address:\t%08X\n", resp.Address)
-		fmt.Fprintf(w, "Data Rate:\t%d - %s\n", resp.DataRateIdx, dataRateString(resp.DataRateIdx))
+		band := getBand(client)
+		fmt.Fprintf(w, "Band:\t%d - %s\n", band.Index, band.Name)
+		fmt.Fprintf(w, "Data Rate:\t%d - %s\n", resp.DataRateIdx, band.DataRateString(resp.DataRateIdx))
 		fmt.Fprintf(w, "Power Level:\t%d dBm\n", resp.PowerLevel)
 		fmt.Fprintf(w, "Max Payload Size:\t%d bytes\n", resp.MaxPayloadSize)
 	}
@@ -389,25 +569,6 @@ func runInfoCommand() {
 		if err != nil {
 			printErrorAndExit(err)
 		}
-		var moduleTypeStr string
-		switch resp.ModuleType {
-		case 0x90:
-			moduleTypeStr = "iM880A"
-		case 0x92:
-			moduleTypeStr = "iM880A-L"
-		case 0x93:
-			moduleTypeStr = "iU880A"
-		case 0x98:
-			moduleTypeStr = "iM880B-L"
-		case 0x99:
-			moduleTypeStr = "iU880B"
-		case 0x9A:
-			moduleTypeStr = "iM980A"
-		case 0xA0:
-			moduleTypeStr = "iM881A"
-		default:
-			moduleTypeStr = "Unknown"
-		}
 		var opModeStr string
 		switch opModeResp.Mode {
 		case 0x00:
@@ -422,7 +583,7 @@ func runInfoCommand() {
 			opModeStr = "Unknown"
 		}
 		fmt.Fprint(w, "\nDEVICE INFO:\n\n")
-		fmt.Fprintf(w, "Module Type:\t%s\n", moduleTypeStr)
+		fmt.Fprintf(w, "Module Type:\t%s\n", moduleTypeString(resp.ModuleType))
 		fmt.Fprintf(w, "Device Address:\t%08X\n", resp.DeviceAddress)
 		fmt.Fprintf(w, "Device ID:\t%08X\n", resp.DeviceID)
 		fmt.Fprintf(w, "Device EUI:\t%v\n", euiResp.EUI)
@@ -467,29 +628,45 @@ func runInfoCommand() {
 		if err != nil {
 			printErrorAndExit(err)
 		}
-		enabled := func(e bool) string {
-			if e {
-				return "enabled"
-			}
-			return "disabled"
-		}
-		fmt.Fprint(w, "\nRADIO INFO:\n\n")
-		fmt.Fprintf(w, "Default Data Rate:\t%d - %s\n", resp.DefaultDataRateIdx, dataRateString(resp.DefaultDataRateIdx))
-		fmt.Fprintf(w, "TX Power Level:\t%d dBm\n", resp.TXPowerLevel)
-		fmt.Fprintf(w, "Adaptative Data Rate:\t%s\n", enabled(resp.AdaptativeDataRate))
-		fmt.Fprintf(w, "Duty Cycle Control:\t%s\n", enabled(resp.DutyCycleControl))
-		fmt.Fprintf(w, "Class C:\t%s\n", enabled(resp.ClassC))
-		fmt.Fprintf(w, "MAC Events:\t%s\n", enabled(resp.MACEvents))
-		fmt.Fprintf(w, "Extended HCI:\t%s\n", enabled(resp.ExtendedHCI))
-		fmt.Fprintf(w, "Automatic Power Saving:\t%s\n", enabled(resp.AutomaticPowerSaving))
-		fmt.Fprintf(w, "Max Retransmissions:\t%d\n", resp.MaxRetransmissions)
-		fmt.Fprintf(w, "Band Index:\t%d\n", resp.BandIdx)
-		fmt.Fprintf(w, "Header MAC Cmd Capacity:\t%d\n", resp.HeaderMACCmdCapacity)
+		printRadioInfo(w, &resp.RStackConfig)
+	}
+
+	if infoBands {
+		resp, err := client.GetSupportedBands()
+		if err != nil {
+			printErrorAndExit(err)
+		}
+		fmt.Fprint(w, "\nSUPPORTED BANDS:\n\n")
+		for _, band := range resp.Bands {
+			fmt.Fprintf(w, "%d - %s:\tmax EIRP %d dBm\n", band.BandIdx, region.Name(band.BandIdx), band.MaxEIRP)
+		}
 	}
 
 	w.Flush()
 }
 
+func printRadioInfo(w io.Writer, config *wimod.RStackConfig) {
+	enabled := func(e bool) string {
+		if e {
+			return "enabled"
+		}
+		return "disabled"
+	}
+	fmt.Fprint(w, "\nRADIO INFO:\n\n")
+	band := lookupBand(config.BandIdx)
+	fmt.Fprintf(w, "Default Data Rate:\t%d - %s\n", config.DefaultDataRateIdx, band.DataRateString(config.DefaultDataRateIdx))
+	fmt.Fprintf(w, "TX Power Level:\t%d dBm\n", config.TXPowerLevel)
+	fmt.Fprintf(w, "Adaptative Data Rate:\t%s\n", enabled(config.AdaptativeDataRate))
+	fmt.Fprintf(w, "Duty Cycle Control:\t%s\n", enabled(config.DutyCycleControl))
+	fmt.Fprintf(w, "Class C:\t%s\n", enabled(config.ClassC))
+	fmt.Fprintf(w, "MAC Events:\t%s\n", enabled(config.MACEvents))
+	fmt.Fprintf(w, "Extended HCI:\t%s\n", enabled(config.ExtendedHCI))
+	fmt.Fprintf(w, "Automatic Power Saving:\t%s\n", enabled(config.AutomaticPowerSaving))
+	fmt.Fprintf(w, "Max Retransmissions:\t%d\n", config.MaxRetransmissions)
+	fmt.Fprintf(w, "Band:\t%d - %s\n", config.BandIdx, band.Name)
+	fmt.Fprintf(w, "Header MAC Cmd Capacity:\t%d\n", config.HeaderMACCmdCapacity)
+}
+
 func runDeactivateCommand() {
 	client := getClient()
 	err := client.DeactivateDevice()
@@ -566,22 +743,14 @@ func otaaJoin() error {
 	if err != nil {
 		return err
 	}
-	err = client.JoinNetwork()
-	if err != nil {
-		return err
-	}
-	_, err = client.JoinNetworkTxInd()
+	result, err := client.JoinNetworkTransaction()
 	if err != nil {
 		return err
 	}
 	w := getTabWriter()
 	fmt.Fprintf(w, "Join packet successfully sent\n")
-	joinedEvent, err := client.JoinNetworkInd()
-	if err != nil {
-		return err
-	}
 	fmt.Fprintf(w, "Device successfully joined\n")
-	fmt.Fprintf(w, "Address:\t%08X\n", joinedEvent.Address)
+	fmt.Fprintf(w, "Address:\t%08X\n", result.Ind.Address)
 	w.Flush()
 	return nil
 }
@@ -663,11 +832,7 @@ func runSendCommand() {
 
 func sendUnconfirmed(port byte, payload []byte) error {
 	client := getClient()
-	_, err := client.SendUData(port, payload)
-	if err != nil {
-		return err
-	}
-	_, err = client.SendUDataTxInd()
+	_, err := client.SendUDataTransaction(port, payload)
 	if err != nil {
 		return err
 	}
@@ -677,6 +842,212 @@ func sendUnconfirmed(port byte, payload []byte) error {
 	return nil
 }
 
+// confirmedAckTimeout leaves the modem time to go through its
+// retransmissions, after which it reports the uplink as not acknowledged.
+const confirmedAckTimeout = time.Minute
+
 func sendConfirmed(port byte, payload []byte) error {
+	acked, err := sendAndAwaitAck(getClient(), port, payload, confirmedAckTimeout)
+	if err != nil {
+		return err
+	}
+	w := getTabWriter()
+	defer w.Flush()
+	if !acked {
+		fmt.Fprintf(w, "Confirmed data sent but not acknowledged after all retransmissions\n")
+		return nil
+	}
+	fmt.Fprintf(w, "Confirmed data successfully sent and acknowledged\n")
 	return nil
 }
+
+// sendAndAwaitAck subscribes to the indications of a confirmed uplink before
+// sending it, so none is missed, and reports whether it was acknowledged
+// before timeout.
+func sendAndAwaitAck(client *client.WimodClient, port byte, payload []byte, timeout time.Duration) (bool, error) {
+	sub, err := client.Subscribe(false, wimod.LORAWAN_MSG_SEND_CDATA_TX_IND, wimod.LORAWAN_MSG_RECV_ACK_IND, wimod.LORAWAN_MSG_RECV_UDATA_IND, wimod.LORAWAN_MSG_RECV_CDATA_IND)
+	if err != nil {
+		return false, err
+	}
+	defer sub.Unsubscribe()
+	_, err = client.SendCData(port, payload)
+	if err != nil {
+		return false, fmt.Errorf("confirmed data rejected: %w", err)
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return false, fmt.Errorf("confirmed data sent but no acknowledgement received within %s: %w", timeout, context.DeadlineExceeded)
+		}
+		ind, _, err := sub.Next(remaining)
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			return false, fmt.Errorf("confirmed data sent but no acknowledgement received within %s: %w", timeout, err)
+		case errors.Is(err, wimod.ErrMaxRetransmissions):
+			return false, nil
+		case errors.Is(err, wimod.ErrMaxPayloadSize):
+			return false, fmt.Errorf("confirmed data rejected: maximum payload size exceeded for current data rate: %w", err)
+		case err != nil:
+			return false, fmt.Errorf("confirmed data rejected: radio packet not sent: %w", err)
+		}
+		switch ind := ind.(type) {
+		case *wimod.RecvAckInd:
+			return true, nil
+		case *wimod.RecvUDataInd:
+			if ind.Ack {
+				return true, nil
+			}
+		case *wimod.RecvCDataInd:
+			if ind.Ack {
+				return true, nil
+			}
+		}
+	}
+}
+
+const linkCheckTimeout = 10 * time.Second
+
+func runLinkcheckCommand() {
+	if linkcheckType != "c" && linkcheckType != "u" {
+		printErrorAndExit(fmt.Errorf("link check type should be (c)onfirmed or (u)nconfirmed"))
+	}
+	client := getClient()
+	config, err := client.GetRStackConfig()
+	if err != nil {
+		printErrorAndExit(err)
+	}
+	if !config.MACEvents {
+		printErrorAndExit(fmt.Errorf("MAC events are disabled, enable them with: loractl config radio -macevents"))
+	}
+	confirmed := linkcheckType == "c"
+	var txIndCode uint16 = wimod.LORAWAN_MSG_SEND_UDATA_TX_IND
+	if confirmed {
+		txIndCode = wimod.LORAWAN_MSG_SEND_CDATA_TX_IND
+	}
+	sub, err := client.Subscribe(false, txIndCode, wimod.LORAWAN_MSG_RECV_MAC_CMD_IND)
+	if err != nil {
+		printErrorAndExit(err)
+	}
+	defer sub.Unsubscribe()
+	err = client.SendMACCmd(confirmed, &mac.LinkCheckReq{})
+	if err != nil {
+		printErrorAndExit(fmt.Errorf("link check request rejected: %w", err))
+	}
+	deadline := time.Now().Add(linkCheckTimeout)
+	for {
+		ind, _, err := sub.Next(max(time.Until(deadline), time.Millisecond))
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			printErrorAndExit(fmt.Errorf("no link check answer received after %s: %w", linkCheckTimeout, err))
+		case errors.Is(err, wimod.ErrMaxRetransmissions):
+			// the request went out, the answer may still come with a later downlink
+			continue
+		case err != nil:
+			printErrorAndExit(fmt.Errorf("link check request not sent: %w", err))
+		}
+		switch ind := ind.(type) {
+		case *wimod.RecvMACCmdInd:
+			cmds, err := ind.Commands()
+			if err != nil {
+				printErrorAndExit(err)
+			}
+			for _, cmd := range cmds {
+				if ans, ok := cmd.(*mac.LinkCheckAns); ok {
+					printLinkCheckAns(ans, ind, lookupBand(config.BandIdx))
+					return
+				}
+			}
+		}
+	}
+}
+
+func printLinkCheckAns(ans *mac.LinkCheckAns, ind *wimod.RecvMACCmdInd, band *region.Band) {
+	w := getTabWriter()
+	fmt.Fprint(w, "\nLINK CHECK:\n\n")
+	fmt.Fprintf(w, "Demodulation Margin:\t%d dB\n", ans.Margin)
+	fmt.Fprintf(w, "Gateway Count:\t%d\n", ans.GwCnt)
+	printRxMetadata(w, &ind.RxMetadata, band)
+	w.Flush()
+}
+
+func printRxMetadata(w io.Writer, m *wimod.RxMetadata, band *region.Band) {
+	if !m.Attached {
+		return
+	}
+	fmt.Fprintf(w, "Channel:\t%d - %s\n", m.ChannelIdx, band.ChannelString(m.ChannelIdx))
+	fmt.Fprintf(w, "Data Rate:\t%d - %s\n", m.DataRateIdx, band.DataRateString(m.DataRateIdx))
+	fmt.Fprintf(w, "RSSI:\t%d dBm\n", m.RSSI)
+	fmt.Fprintf(w, "SNR:\t%d dB\n", m.SNR)
+	fmt.Fprintf(w, "Rx Slot:\t%d\n", m.RxSlot)
+}
+
+type downlink struct {
+	confirmed bool
+	ack       bool
+	port      byte
+	payload   []byte
+	metadata  wimod.RxMetadata
+}
+
+func runListenCommand() {
+	if listenEnc != "ascii" && listenEnc != "hex" && listenEnc != "b64" {
+		printErrorAndExit(fmt.Errorf("encoding should be ascii, hex or b64"))
+	}
+	client := getClient()
+	band := getBand(client)
+	sub, err := client.Subscribe(true, wimod.LORAWAN_MSG_RECV_UDATA_IND, wimod.LORAWAN_MSG_RECV_CDATA_IND)
+	if err != nil {
+		printErrorAndExit(err)
+	}
+	for {
+		ind, outcome, err := sub.Next(0)
+		if err != nil {
+			printErrorAndExit(err)
+		}
+		switch ind := ind.(type) {
+		case *wimod.RecvUDataInd:
+			printDownlink(downlink{false, ind.Ack, ind.Port, ind.Payload, ind.RxMetadata}, band)
+		case *wimod.RecvCDataInd:
+			printDownlink(downlink{true, ind.Ack, ind.Port, ind.Payload, ind.RxMetadata}, band)
+		}
+		if outcome != nil {
+			printRxOutcome(outcome, band)
+		}
+	}
+}
+
+func printRxOutcome(outcome *controller.RxOutcome, band *region.Band) {
+	w := getTabWriter()
+	fmt.Fprintf(w, "\nRX OUTCOME (%s):\t%s\n", time.Now().Format(time.RFC3339), outcome.Type)
+	if outcome.Type == controller.RxOutcomeNoData && outcome.ErrorCode != 0 {
+		fmt.Fprintf(w, "Error Code:\t%08b\n", outcome.ErrorCode)
+	}
+	printRxMetadata(w, &outcome.Metadata, band)
+	w.Flush()
+}
+
+func printDownlink(d downlink, band *region.Band) {
+	w := getTabWriter()
+	typeStr := "unconfirmed"
+	if d.confirmed {
+		typeStr = "confirmed"
+	}
+	fmt.Fprintf(w, "\nDOWNLINK RECEIVED (%s):\n\n", d.metadata.ReceivedAt.Format(time.RFC3339))
+	fmt.Fprintf(w, "Type:\t%s\n", typeStr)
+	fmt.Fprintf(w, "Ack:\t%t\n", d.ack)
+	fmt.Fprintf(w, "Port:\t%d\n", d.port)
+	fmt.Fprintf(w, "Payload:\t%s\n", formatPayload(d.payload, listenEnc))
+	printRxMetadata(w, &d.metadata, band)
+	w.Flush()
+}
+
+func formatPayload(payload []byte, enc string) string {
+	switch enc {
+	case "ascii":
+		return fmt.Sprintf("%q", payload)
+	case "b64":
+		return base64.StdEncoding.EncodeToString(payload)
+	}
+	return hex.EncodeToString(payload)
+}
@@ -2,13 +2,26 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"net"
+	"net/rpc"
+	"runtime"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/enolgor/wimod-lorawan-endnode-controller/controller"
 	"github.com/enolgor/wimod-lorawan-endnode-controller/crc"
+	"github.com/enolgor/wimod-lorawan-endnode-controller/hci"
+	"github.com/enolgor/wimod-lorawan-endnode-controller/mac"
+	"github.com/enolgor/wimod-lorawan-endnode-controller/region"
+	"github.com/enolgor/wimod-lorawan-endnode-controller/rpc/client"
+	"github.com/enolgor/wimod-lorawan-endnode-controller/rpc/server"
 	"github.com/enolgor/wimod-lorawan-endnode-controller/slip"
 	"github.com/enolgor/wimod-lorawan-endnode-controller/wimod"
 	"github.com/tarm/serial"
@@ -325,7 +338,7 @@ func TestBlocked(t *testing.T) {
 	if err != nil {
 		log.Fatal(err)
 	}
-	config := &controller.WiModControllerConfig{s, 1, false}
+	config := &controller.WiModControllerConfig{Stream: s, EventBufferSize: 1, EventNoBlock: false}
 	controller := controller.NewController(config)
 	now := time.Now().UTC().Add(2 * time.Second)
 	req := wimod.NewSetRTCAlarmReq(wimod.AlarmSingle, byte(now.Hour()), byte(now.Minute()), byte(now.Second()))
@@ -431,3 +444,1046 @@ func TestSizes(t *testing.T) {
 	b := []byte{0x11, 0x22}
 	fmt.Printf("%X\n", b[2:])
 }
+
+func TestRecvUDataInd(t *testing.T) {
+	payload := []byte{0x03, 0x05, 0xAA, 0xBB, 0x02, 0x05, 0xB5, 0x07, 0x01}
+	ind := wimod.NewRecvUDataInd()
+	err := ind.Decode(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println(ind)
+	if !ind.Ack || ind.Port != 5 || !bytes.Equal(ind.Payload, []byte{0xAA, 0xBB}) {
+		t.Error("Wrong data decoded")
+	}
+	if ind.ChannelIdx != 2 || ind.DataRateIdx != 5 || ind.RSSI != -75 || ind.SNR != 7 || ind.RxSlot != 1 {
+		t.Error("Wrong attachment decoded")
+	}
+}
+
+func TestRStackConfig(t *testing.T) {
+	config := wimod.RStackConfig{DefaultDataRateIdx: 5, TXPowerLevel: 14, AdaptativeDataRate: true, ClassC: true, ExtendedHCI: true, MaxRetransmissions: 3, BandIdx: 1, HeaderMACCmdCapacity: 15}
+	payload, err := wimod.NewSetRStackConfigReq(config).Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Printf("%X\n", payload)
+	resp := wimod.NewGetRStackConfigResp()
+	err = resp.Decode(append([]byte{wimod.LORAWAN_STATUS_OK}, payload...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.RStackConfig != config {
+		t.Errorf("Decoded config %v does not match encoded config %v", &resp.RStackConfig, &config)
+	}
+}
+
+func TestSetDeviceEUI(t *testing.T) {
+	eui, err := wimod.ParseEUI("70B3D57ED0001234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := wimod.NewSetDeviceEUIReq(eui).Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Printf("%X\n", payload)
+	resp := wimod.NewGetDeviceEUIResp()
+	err = resp.Decode(append([]byte{wimod.LORAWAN_STATUS_OK}, payload...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.EUI != eui {
+		t.Errorf("Decoded EUI %v does not match encoded EUI %v", resp.EUI, eui)
+	}
+}
+
+func TestRecvMACCmdInd(t *testing.T) {
+	payload := []byte{0x01, 0x02, 0x14, 0x03, 0x06, 0x03, 0x53, 0xFF, 0x00, 0x01, 0x02, 0x05, 0xB5, 0x07, 0x01}
+	ind := wimod.NewRecvMACCmdInd()
+	err := ind.Decode(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println(ind)
+	cmds, err := ind.Commands()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println(cmds)
+	if len(cmds) != 3 {
+		t.Fatalf("Expected 3 MAC commands, got %d", len(cmds))
+	}
+	ans, ok := cmds[0].(*mac.LinkCheckAns)
+	if !ok || ans.Margin != 20 || ans.GwCnt != 3 {
+		t.Error("Wrong LinkCheckAns decoded")
+	}
+	adr, ok := cmds[2].(*mac.LinkADRReq)
+	if !ok || adr.DataRate != 5 || adr.TXPower != 3 || adr.ChMask != 0x00FF || adr.NbTrans != 1 {
+		t.Error("Wrong LinkADRReq decoded")
+	}
+	if !bytes.Equal(mac.Encode(cmds...), ind.MACCommands) {
+		t.Error("Encoded MAC commands do not match decoded ones")
+	}
+	if ind.RSSI != -75 || ind.RxSlot != 1 {
+		t.Error("Wrong attachment decoded")
+	}
+	status := &mac.DevStatusAns{}
+	err = status.Decode([]byte{0xFE, 0x3E})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Margin != -2 {
+		t.Errorf("Expected margin -2, got %d", status.Margin)
+	}
+	_, err = mac.DecodeDownlink([]byte{0x02, 0x14})
+	if err == nil {
+		t.Error("Truncated MAC command list should fail to decode")
+	}
+}
+
+func TestCustomCfg(t *testing.T) {
+	payload, err := wimod.NewSetCustomCfgReq(-3).Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Printf("%X\n", payload)
+	resp := wimod.NewGetCustomCfgResp()
+	err = resp.Decode(append([]byte{wimod.LORAWAN_STATUS_OK}, payload...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.RFGain != -3 {
+		t.Errorf("Expected RF gain -3, got %d", resp.RFGain)
+	}
+}
+
+func TestSupportedBands(t *testing.T) {
+	resp := wimod.NewGetSupportedBandsResp()
+	err := resp.Decode([]byte{wimod.LORAWAN_STATUS_OK, 0x01, 0x10, 0x81, 0x10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println(resp)
+	if len(resp.Bands) != 2 || resp.Bands[1].BandIdx != 0x81 || resp.Bands[1].MaxEIRP != 16 {
+		t.Error("Wrong bands decoded")
+	}
+	if _, ok := region.Lookup(3); ok {
+		t.Error("Band 3 has no verified index and should be unknown")
+	}
+	band, ok := region.Lookup(region.BAND_IN865)
+	if !ok {
+		t.Fatal("IN865 band not found")
+	}
+	if s := band.ChannelString(1); s != "865.403 MHz" {
+		t.Errorf("Wrong IN865 channel: %s", s)
+	}
+	band, _ = region.Lookup(region.BAND_EU868)
+	if s := band.DataRateString(7); s != "FSK 50K, -, 50000bps" {
+		t.Errorf("Wrong EU868 data rate: %s", s)
+	}
+}
+
+func TestExtendedHCI(t *testing.T) {
+	join := wimod.NewJoinNetworkInd()
+	err := join.Decode([]byte{0x01, 0x78, 0x56, 0x34, 0x12, 0x01, 0x05, 0xB0, 0xF9, 0x01})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println(join)
+	if join.Address != 0x12345678 || !join.Attached || join.RSSI != -80 || join.SNR != -7 {
+		t.Error("Wrong join indication decoded")
+	}
+	join = wimod.NewJoinNetworkInd()
+	join.Decode([]byte{0x00, 0x78, 0x56, 0x34, 0x12})
+	if join.Address != 0x12345678 || join.Attached {
+		t.Error("Wrong join indication without attachment decoded")
+	}
+	tx := wimod.NewSendUDataTxInd()
+	err = tx.Decode([]byte{0x01, 0x02, 0x05, 0x01, 0x0E, 0x3D, 0x00, 0x00, 0x00})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tx.Attached || tx.NumTxPackets != 1 || tx.TRXPowerLevel != 14 || tx.RFMessageAirtime != 61 {
+		t.Error("Wrong tx indication decoded")
+	}
+	inds := []wimod.RxIndication{wimod.NewRecvUDataInd(), wimod.NewRecvCDataInd(), wimod.NewRecvAckInd(), wimod.NewRecvMACCmdInd(), join}
+	for _, ind := range inds {
+		ind.Decode([]byte{0x01, 0x02, 0x05, 0xB5, 0x07, 0x01})
+		if m := ind.RxInfo(); !m.Attached || m.RSSI != -75 || m.RxSlot != 1 || m.ReceivedAt.IsZero() {
+			t.Errorf("Wrong metadata decoded for %v", ind)
+		}
+	}
+}
+
+type pipeStream struct {
+	*io.PipeReader
+	modem   *io.PipeWriter
+	replies chan hci.HCIPacket
+}
+
+func newPipeStream() *pipeStream {
+	r, w := io.Pipe()
+	return &pipeStream{r, w, make(chan hci.HCIPacket, 10)}
+}
+
+// Write answers a request with every queued reply.
+func (p *pipeStream) Write(b []byte) (int, error) {
+	if len(b) > 1 {
+		var frames []byte
+		for len(p.replies) > 0 {
+			reply := <-p.replies
+			frames = append(frames, slip.SlipEncode(reply.Encode())...)
+		}
+		if len(frames) > 0 {
+			go p.modem.Write(frames)
+		}
+	}
+	return len(b), nil
+}
+
+func TestRequestTimeout(t *testing.T) {
+	stream := newPipeStream()
+	c := controller.NewController(&controller.WiModControllerConfig{Stream: stream, RequestTimeout: 50 * time.Millisecond})
+	err := c.Request(wimod.NewGetRTCReq(), wimod.NewGetRTCResp())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline exceeded, got %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	err = c.ReadSpecificIndContext(ctx, wimod.NewRecvUDataInd())
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected canceled, got %v", err)
+	}
+	resp := wimod.NewGetRTCResp()
+	stream.replies <- hci.HCIPacket{Dst: resp.Dst(), ID: resp.ID(), Payload: []byte{wimod.DEVMGMT_STATUS_OK, 0x00, 0x00, 0x00, 0x00}}
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err = c.RequestContext(ctx, wimod.NewGetRTCReq(), resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = controller.NewController(&controller.WiModControllerConfig{Stream: newPipeStream(), IndicationTimeout: 50 * time.Millisecond})
+	err = c.ReadSpecificInd(wimod.NewRecvUDataInd())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	stream := newPipeStream()
+	c := controller.NewController(&controller.WiModControllerConfig{Stream: stream})
+	noData := c.SubscribeWithConfig(controller.SubscriptionConfig{BufferSize: 1}, wimod.LORAWAN_MSG_RECV_NO_DATA_IND)
+	defer noData.Unsubscribe()
+	all := c.Subscribe()
+	ind := wimod.NewRecvNoDataInd()
+	for i := byte(0); i < 3; i++ {
+		packet := hci.HCIPacket{Dst: ind.Dst(), ID: ind.ID(), Payload: []byte{wimod.LORAWAN_MSG_RECV_NO_DATA_IND_STATUS_ERROR_CODE, i}}
+		stream.modem.Write(slip.SlipEncode(packet.Encode()))
+		select {
+		case recv := <-all.C():
+			if recv.(*wimod.RecvNoDataInd).ErrorCode != i {
+				t.Fatalf("Expected error code %d, got %v", i, recv)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Timeout waiting for indication")
+		}
+	}
+	all.Unsubscribe()
+	if _, ok := <-all.C(); ok {
+		t.Fatal("Expected closed subscription")
+	}
+	recv := <-noData.C()
+	if recv.(*wimod.RecvNoDataInd).ErrorCode != 2 || noData.Dropped() != 2 {
+		t.Fatalf("Expected only the newest indication, got %v (dropped %d)", recv, noData.Dropped())
+	}
+	txInd := wimod.NewSendUDataTxInd()
+	tx := c.Subscribe(txInd.Code())
+	defer tx.Unsubscribe()
+	packet := hci.HCIPacket{Dst: txInd.Dst(), ID: txInd.ID(), Payload: []byte{wimod.LORAWAN_MSG_SEND_UDATA_TX_IND_STATUS_ERROR}}
+	stream.modem.Write(slip.SlipEncode(packet.Encode()))
+	select {
+	case recv := <-tx.C():
+		if recv.(*wimod.SendUDataTxInd).Status != wimod.LORAWAN_MSG_SEND_UDATA_TX_IND_STATUS_ERROR {
+			t.Fatalf("Expected a failed tx indication, got %v", recv)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for the failed tx indication")
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	stream := newPipeStream()
+	c := controller.NewController(&controller.WiModControllerConfig{Stream: stream, RequestTimeout: 100 * time.Millisecond, IndicationTimeout: 200 * time.Millisecond})
+	result := controller.JoinNetworkResult{}
+	result.Resp.Init()
+	result.TxInd.Init()
+	result.Ind.Init()
+	stream.replies <- hci.HCIPacket{Dst: result.Resp.Dst(), ID: result.Resp.ID(), Payload: []byte{wimod.LORAWAN_STATUS_OK}}
+	stream.replies <- hci.HCIPacket{Dst: result.TxInd.Dst(), ID: result.TxInd.ID(), Payload: []byte{wimod.LORAWAN_MSG_JOIN_NETWORK_TX_IND_STATUS_OK}}
+	stream.replies <- hci.HCIPacket{Dst: result.Ind.Dst(), ID: result.Ind.ID(), Payload: []byte{wimod.LORAWAN_MSG_JOIN_NETWORK_IND_STATUS_OK, 0x78, 0x56, 0x34, 0x12}}
+	err := c.Transaction(wimod.NewJoinNetworkReq(), &result.Resp, &result.TxInd, &result.Ind)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Ind.Address != 0x12345678 {
+		t.Fatalf("Expected address 12345678, got %08X", result.Ind.Address)
+	}
+	resp := wimod.NewSendUDataResp()
+	err = c.Transaction(wimod.NewSendUDataReq(1, []byte{0x01}), resp, wimod.NewSendUDataTxInd())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline exceeded, got %v", err)
+	}
+	stream.replies <- hci.HCIPacket{Dst: resp.Dst(), ID: resp.ID(), Payload: []byte{wimod.LORAWAN_STATUS_OK}}
+	err = c.Transaction(wimod.NewSendUDataReq(1, []byte{0x01}), resp, wimod.NewSendUDataTxInd())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline exceeded, got %v", err)
+	}
+	if stats := c.Stats(); stats.RequestTimeouts != 1 || stats.IndicationTimeouts != 1 {
+		t.Fatalf("Expected one request and one indication timeout, got %+v", stats)
+	}
+}
+
+func TestTransactionDeadline(t *testing.T) {
+	stream := newPipeStream()
+	deadlines := make(chan time.Time, 1)
+	deadline := func(ctx context.Context, req wimod.WiModMessageReq, resp wimod.WiModMessageResp, next controller.RequestHandler) error {
+		d, ok := ctx.Deadline()
+		if !ok {
+			t.Error("Expected a transaction deadline with the default config")
+		}
+		deadlines <- d
+		return next(ctx, req, resp)
+	}
+	c := controller.NewController(&controller.WiModControllerConfig{Stream: stream, RequestInterceptors: []controller.RequestInterceptor{deadline}})
+	result := controller.SendUDataResult{}
+	result.Resp.Init()
+	result.TxInd.Init()
+	stream.replies <- hci.HCIPacket{Dst: result.Resp.Dst(), ID: result.Resp.ID(), Payload: []byte{wimod.LORAWAN_STATUS_OK}}
+	stream.replies <- hci.HCIPacket{Dst: result.TxInd.Dst(), ID: result.TxInd.ID(), Payload: []byte{wimod.LORAWAN_MSG_SEND_UDATA_TX_IND_STATUS_OK}}
+	start := time.Now()
+	err := c.Transaction(wimod.NewSendUDataReq(1, []byte{0x01}), &result.Resp, &result.TxInd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := controller.DefaultRequestTimeout + controller.DefaultIndicationTimeout
+	if d := (<-deadlines).Sub(start); d < expected || d > expected+time.Second {
+		t.Fatalf("Expected a deadline of %s, got %s", expected, d)
+	}
+}
+
+func TestRxOutcome(t *testing.T) {
+	stream := newPipeStream()
+	c := controller.NewController(&controller.WiModControllerConfig{Stream: stream, IndicationTimeout: 200 * time.Millisecond})
+	outcomes, stop := c.WatchRxOutcomes()
+	defer stop()
+	nextOutcome := func(packets ...hci.HCIPacket) controller.RxOutcome {
+		for _, packet := range packets {
+			stream.modem.Write(slip.SlipEncode(packet.Encode()))
+		}
+		select {
+		case outcome := <-outcomes:
+			return outcome
+		case <-time.After(time.Second):
+			t.Fatal("Timeout waiting for rx outcome")
+		}
+		return controller.RxOutcome{}
+	}
+	uTxInd, cTxInd := wimod.NewSendUDataTxInd(), wimod.NewSendCDataTxInd()
+	noData, ack := wimod.NewRecvNoDataInd(), wimod.NewRecvAckInd()
+	outcome := nextOutcome(
+		hci.HCIPacket{Dst: uTxInd.Dst(), ID: uTxInd.ID(), Payload: []byte{wimod.LORAWAN_MSG_SEND_UDATA_TX_IND_STATUS_OK}},
+		hci.HCIPacket{Dst: noData.Dst(), ID: noData.ID(), Payload: []byte{wimod.LORAWAN_MSG_RECV_NO_DATA_IND_STATUS_ERROR_CODE, 0x02}},
+	)
+	if outcome.Type != controller.RxOutcomeNoData || outcome.UplinkCode != wimod.LORAWAN_MSG_SEND_UDATA_TX_IND || outcome.IndCode != wimod.LORAWAN_MSG_RECV_NO_DATA_IND || outcome.ErrorCode != 0x02 {
+		t.Fatalf("Unexpected outcome %v", outcome)
+	}
+	outcome = nextOutcome(
+		hci.HCIPacket{Dst: cTxInd.Dst(), ID: cTxInd.ID(), Payload: []byte{wimod.LORAWAN_MSG_SEND_CDATA_TX_IND_STATUS_OK}},
+		hci.HCIPacket{Dst: ack.Dst(), ID: ack.ID(), Payload: []byte{0x00}},
+	)
+	if outcome.Type != controller.RxOutcomeAck || outcome.UplinkCode != wimod.LORAWAN_MSG_SEND_CDATA_TX_IND {
+		t.Fatalf("Unexpected outcome %v", outcome)
+	}
+	// neither the indication without a pending uplink nor the one after an
+	// unsent uplink has an outcome, the next one is that of the last uplink
+	outcome = nextOutcome(
+		hci.HCIPacket{Dst: noData.Dst(), ID: noData.ID(), Payload: []byte{0x00}},
+		hci.HCIPacket{Dst: uTxInd.Dst(), ID: uTxInd.ID(), Payload: []byte{wimod.LORAWAN_MSG_SEND_UDATA_TX_IND_STATUS_ERROR}},
+		hci.HCIPacket{Dst: noData.Dst(), ID: noData.ID(), Payload: []byte{0x00}},
+		hci.HCIPacket{Dst: cTxInd.Dst(), ID: cTxInd.ID(), Payload: []byte{wimod.LORAWAN_MSG_SEND_CDATA_TX_IND_STATUS_OK}},
+		hci.HCIPacket{Dst: noData.Dst(), ID: noData.ID(), Payload: []byte{wimod.LORAWAN_MSG_RECV_NO_DATA_IND_STATUS_ERROR_CODE, 0x01}},
+	)
+	if outcome.Type != controller.RxOutcomeNoData || outcome.UplinkCode != wimod.LORAWAN_MSG_SEND_CDATA_TX_IND || outcome.ErrorCode != 0x01 {
+		t.Fatalf("Unexpected outcome %v", outcome)
+	}
+	_, err := c.ReadRxOutcome()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline exceeded without a pending uplink, got %v", err)
+	}
+	c.Close()
+	_, err = c.ReadRxOutcome()
+	if !errors.Is(err, controller.ErrClosed) {
+		t.Fatalf("Expected closed, got %v", err)
+	}
+	if _, ok := <-outcomes; ok {
+		t.Fatal("Expected the watched outcomes to be closed")
+	}
+}
+
+func TestRequestQueue(t *testing.T) {
+	stream := newPipeStream()
+	c := controller.NewController(&controller.WiModControllerConfig{Stream: stream, RequestTimeout: 200 * time.Millisecond, RequestQueueSize: 1})
+	done := make(chan error, 2)
+	go func() {
+		done <- c.Request(wimod.NewGetRTCReq(), wimod.NewGetRTCResp())
+	}()
+	time.Sleep(20 * time.Millisecond)
+	go func() {
+		done <- c.Request(wimod.NewSendUDataReq(1, []byte{0x01}), wimod.NewSendUDataResp())
+	}()
+	time.Sleep(20 * time.Millisecond)
+	stats := c.QueueStats()
+	if !stats.InFlight || stats.Depth != 1 {
+		t.Fatalf("Expected one request in flight and one queued, got %+v", stats)
+	}
+	err := c.Request(wimod.NewPingReq(), wimod.NewPingResp())
+	if !errors.Is(err, controller.ErrQueueFull) {
+		t.Fatalf("Expected queue full, got %v", err)
+	}
+	<-done
+	<-done
+	stats = c.QueueStats()
+	if stats.InFlight || stats.Depth != 0 || stats.Served != 2 || stats.Rejected != 1 || stats.MaxWait == 0 {
+		t.Fatalf("Unexpected queue stats %+v", stats)
+	}
+	if controller.RequestPriority(wimod.DEVMGMT_MSG_PING_REQ) <= controller.RequestPriority(wimod.LORAWAN_MSG_SEND_UDATA_REQ) {
+		t.Fatal("Expected management requests ahead of uplinks")
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	stream := newPipeStream()
+	streams := make(chan *pipeStream, 1)
+	dial := func() (io.ReadWriteCloser, error) {
+		s := newPipeStream()
+		streams <- s
+		return s, nil
+	}
+	c := controller.NewController(&controller.WiModControllerConfig{Stream: stream, Dial: dial, ReconnectBackoff: 10 * time.Millisecond})
+	events, stop := c.WatchConnection()
+	defer stop()
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Request(wimod.NewGetRTCReq(), wimod.NewGetRTCResp())
+	}()
+	time.Sleep(20 * time.Millisecond)
+	stream.modem.CloseWithError(errors.New("unplugged"))
+	err := <-done
+	var disconnected *controller.DisconnectedError
+	if !errors.As(err, &disconnected) || !errors.Is(err, controller.ErrDisconnected) {
+		t.Fatalf("Expected disconnected error, got %v", err)
+	}
+	for _, state := range []controller.ConnectionState{controller.ConnectionDisconnected, controller.ConnectionReconnecting, controller.ConnectionConnected} {
+		select {
+		case event := <-events:
+			if event.State != state {
+				t.Fatalf("Expected %s, got %v", state, event)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout waiting for %s", state)
+		}
+	}
+	stream = <-streams
+	resp := wimod.NewGetRTCResp()
+	stream.replies <- hci.HCIPacket{Dst: resp.Dst(), ID: resp.ID(), Payload: []byte{wimod.DEVMGMT_STATUS_OK, 0x00, 0x00, 0x00, 0x00}}
+	err = c.Request(wimod.NewGetRTCReq(), resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	stream := newPipeStream()
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	traced := make(chan controller.Direction, 2)
+	trace := func(direction controller.Direction, packet hci.HCIPacket) {
+		traced <- direction
+	}
+	c := controller.NewController(&controller.WiModControllerConfig{Stream: stream, Logger: logger, Trace: trace})
+	resp := wimod.NewGetRTCResp()
+	stream.replies <- hci.HCIPacket{Dst: resp.Dst(), ID: resp.ID(), Payload: []byte{wimod.DEVMGMT_STATUS_OK, 0x00, 0x00, 0x00, 0x00}}
+	err := c.Request(wimod.NewGetRTCReq(), resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if <-traced != controller.DirectionTx || <-traced != controller.DirectionRx {
+		t.Fatal("Expected the request and the response to be traced")
+	}
+	if !strings.Contains(logs.String(), "message=DEVMGMT_MSG_GET_RTC_RSP") {
+		t.Fatalf("Expected the response to be logged, got %s", logs.String())
+	}
+}
+
+type recordStream struct {
+	*pipeStream
+	writes chan []byte
+}
+
+func (r *recordStream) Write(b []byte) (int, error) {
+	r.writes <- append([]byte(nil), b...)
+	return r.pipeStream.Write(b)
+}
+
+func TestWakeUp(t *testing.T) {
+	stream := &recordStream{newPipeStream(), make(chan []byte, 10)}
+	c := controller.NewController(&controller.WiModControllerConfig{Stream: stream, RequestTimeout: 50 * time.Millisecond, WakeUpLength: 8, WakeUpIdleThreshold: time.Hour})
+	payload, err := wimod.NewSetRStackConfigReq(wimod.RStackConfig{BandIdx: 1}).Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := wimod.NewGetRStackConfigResp()
+	stream.replies <- hci.HCIPacket{Dst: resp.Dst(), ID: resp.ID(), Payload: append([]byte{wimod.LORAWAN_STATUS_OK}, payload...)}
+	err = c.Request(wimod.NewGetRStackConfigReq(), resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := <-stream.writes
+	if !bytes.Equal(write[:9], bytes.Repeat([]byte{slip.SLIP_END}, 9)) || write[9] == slip.SLIP_END {
+		t.Fatalf("Expected a wake-up preamble of 8 bytes in the same write, got %X", write)
+	}
+	c.Request(wimod.NewPingReq(), wimod.NewPingResp())
+	write = <-stream.writes
+	if write[1] == slip.SLIP_END {
+		t.Fatalf("Expected no wake-up preamble with power saving off, got %X", write)
+	}
+}
+
+func TestClose(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+	stream := newPipeStream()
+	c := controller.NewController(&controller.WiModControllerConfig{Stream: stream, RequestTimeout: -1})
+	sub := c.Subscribe()
+	errs := make(chan error, 2)
+	go func() {
+		errs <- c.Request(wimod.NewGetRTCReq(), wimod.NewGetRTCResp())
+	}()
+	go func() {
+		_, err := c.ReadInd()
+		errs <- err
+	}()
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	if err := c.Run(ctx); !errors.Is(err, controller.ErrClosed) {
+		t.Fatalf("Expected controller closed, got %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; !errors.Is(err, controller.ErrClosed) {
+			t.Fatalf("Expected controller closed, got %v", err)
+		}
+	}
+	if _, ok := <-sub.C(); ok || !errors.Is(sub.Err(), controller.ErrClosed) {
+		t.Fatal("Expected subscription closed")
+	}
+	c.Close()
+	for i := 0; runtime.NumGoroutine() > goroutines; i++ {
+		if i == 100 {
+			t.Fatalf("Expected %d goroutines after close, got %d", goroutines, runtime.NumGoroutine())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	stream = newPipeStream()
+	c = controller.NewController(&controller.WiModControllerConfig{Stream: stream})
+	stream.modem.CloseWithError(errors.New("unplugged"))
+	<-c.Done()
+	if !errors.Is(c.Err(), controller.ErrClosed) || !errors.Is(c.Err(), controller.ErrDisconnected) {
+		t.Fatalf("Expected controller closed after disconnection, got %v", c.Err())
+	}
+}
+
+func TestStats(t *testing.T) {
+	stream := newPipeStream()
+	c := controller.NewController(&controller.WiModControllerConfig{Stream: stream})
+	defer c.Close()
+	resp := wimod.NewGetRTCResp()
+	stream.replies <- hci.HCIPacket{Dst: resp.Dst(), ID: resp.ID(), Payload: []byte{wimod.DEVMGMT_STATUS_OK, 0x00, 0x00, 0x00, 0x00}}
+	err := c.Request(wimod.NewGetRTCReq(), resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ping := wimod.NewPingResp()
+	unsolicited := hci.HCIPacket{Dst: ping.Dst(), ID: ping.ID(), Payload: []byte{wimod.DEVMGMT_STATUS_OK}}
+	badCRC := unsolicited.Encode()
+	badCRC[len(badCRC)-1] ^= 0xFF
+	stream.modem.Write(slip.SlipEncode(unsolicited.Encode()))
+	stream.modem.Write(slip.SlipEncode(badCRC))
+	stream.modem.Write([]byte{slip.SLIP_END, 0x01, slip.SLIP_ESC, 0x01, slip.SLIP_END})
+	stream.modem.Write(slip.SlipEncode(unsolicited.Encode()))
+	var stats controller.Stats
+	for i := 0; i < 100; i++ {
+		if stats = c.Stats(); stats.DiscardedPackets == 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if stats.DiscardedPackets != 2 || stats.CRCErrors != 1 || stats.FramingErrors != 1 || stats.PacketsIn != 3 || stats.PacketsOut != 1 {
+		t.Fatalf("Unexpected stats %+v", stats)
+	}
+	if stats.BytesIn == 0 || stats.BytesOut == 0 || stats.Requests != 1 || stats.Latency["DEVMGMT_MSG_GET_RTC_REQ"].Count != 1 {
+		t.Fatalf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestInterceptors(t *testing.T) {
+	stream := newPipeStream()
+	rtc := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	dryRun := func(ctx context.Context, req wimod.WiModMessageReq, resp wimod.WiModMessageResp, next controller.RequestHandler) error {
+		if _, ok := req.(*wimod.PingReq); ok {
+			return nil
+		}
+		return next(ctx, req, resp)
+	}
+	fixRTC := func(ctx context.Context, req wimod.WiModMessageReq, resp wimod.WiModMessageResp, next controller.RequestHandler) error {
+		err := next(ctx, req, resp)
+		if resp, ok := resp.(*wimod.GetRTCResp); ok && err == nil {
+			resp.Time = rtc
+		}
+		return err
+	}
+	dropFirst := func(packet hci.HCIPacket, next controller.IndicationHandler) {
+		if packet.Payload[1] != 0 {
+			next(packet)
+		}
+	}
+	c := controller.NewController(&controller.WiModControllerConfig{
+		Stream:                 stream,
+		RequestInterceptors:    []controller.RequestInterceptor{dryRun, fixRTC},
+		IndicationInterceptors: []controller.IndicationInterceptor{dropFirst},
+	})
+	defer c.Close()
+	if err := c.Request(wimod.NewPingReq(), wimod.NewPingResp()); err != nil {
+		t.Fatal(err)
+	}
+	if stats := c.Stats(); stats.PacketsOut != 0 {
+		t.Fatalf("Expected the ping to be short-circuited, sent %d packets", stats.PacketsOut)
+	}
+	resp := wimod.NewGetRTCResp()
+	stream.replies <- hci.HCIPacket{Dst: resp.Dst(), ID: resp.ID(), Payload: []byte{wimod.DEVMGMT_STATUS_OK, 0x00, 0x00, 0x00, 0x00}}
+	if err := c.Request(wimod.NewGetRTCReq(), resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Time.Equal(rtc) {
+		t.Fatalf("Expected %v, got %v", rtc, resp.Time)
+	}
+	sub := c.Subscribe(wimod.LORAWAN_MSG_RECV_NO_DATA_IND)
+	defer sub.Unsubscribe()
+	ind := wimod.NewRecvNoDataInd()
+	for i := byte(0); i < 2; i++ {
+		packet := hci.HCIPacket{Dst: ind.Dst(), ID: ind.ID(), Payload: []byte{wimod.LORAWAN_MSG_RECV_NO_DATA_IND_STATUS_ERROR_CODE, i}}
+		stream.modem.Write(slip.SlipEncode(packet.Encode()))
+	}
+	select {
+	case recv := <-sub.C():
+		if recv.(*wimod.RecvNoDataInd).ErrorCode != 1 {
+			t.Fatalf("Expected the first indication to be dropped, got %v", recv)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for indication")
+	}
+}
+
+func TestSLIPFraming(t *testing.T) {
+	var stream bytes.Buffer
+	encoder := slip.NewEncoder(&stream)
+	encoder.Write([]byte{0x01, slip.SLIP_END})
+	encoder.Write([]byte{slip.SLIP_ESC, 0x02})
+	encoder.EndFrame()
+	encoder.WriteFrame(bytes.Repeat([]byte{0x03}, 5))
+	stream.Write([]byte{slip.SLIP_END, 0x04, slip.SLIP_ESC, 0x04, slip.SLIP_END})
+	encoder.WriteFrame([]byte{0x05})
+	stream.Write([]byte{slip.SLIP_END, 0x06})
+	decoder := slip.NewDecoderSize(&stream, 4)
+	frame, err := decoder.ReadFrame()
+	if err != nil || !bytes.Equal(frame, []byte{0x01, slip.SLIP_END, slip.SLIP_ESC, 0x02}) {
+		t.Fatalf("Unexpected frame %X (%v)", frame, err)
+	}
+	for _, expected := range []error{slip.ErrFrameTooLarge, slip.ErrInvalidEscape} {
+		if _, err := decoder.ReadFrame(); !errors.Is(err, expected) {
+			t.Fatalf("Expected %v, got %v", expected, err)
+		}
+	}
+	if frame, err := decoder.ReadFrame(); err != nil || !bytes.Equal(frame, []byte{0x05}) {
+		t.Fatalf("Unexpected frame %X (%v)", frame, err)
+	}
+	if _, err := decoder.ReadFrame(); !errors.Is(err, slip.ErrTruncatedFrame) {
+		t.Fatalf("Expected truncated frame, got %v", err)
+	}
+	if _, err := decoder.ReadFrame(); err != io.EOF {
+		t.Fatalf("Expected EOF, got %v", err)
+	}
+}
+
+func BenchmarkSLIPReadFrame(b *testing.B) {
+	ind := wimod.NewRecvUDataInd()
+	packet := hci.HCIPacket{Dst: ind.Dst(), ID: ind.ID(), Payload: append([]byte{wimod.LORAWAN_STATUS_OK, 0x00, 0x01}, bytes.Repeat([]byte{0xAA}, 32)...)}
+	frame := slip.SlipEncode(packet.Encode())
+	stream := bytes.NewReader(nil)
+	decoder := slip.NewDecoder(stream)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		stream.Reset(frame)
+		if _, err := decoder.ReadFrame(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkIndications(b *testing.B) {
+	stream := newPipeStream()
+	c := controller.NewController(&controller.WiModControllerConfig{Stream: stream, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	defer c.Close()
+	sub := c.SubscribeWithConfig(controller.SubscriptionConfig{BufferSize: 1024}, wimod.LORAWAN_MSG_RECV_UDATA_IND)
+	defer sub.Unsubscribe()
+	ind := wimod.NewRecvUDataInd()
+	packet := hci.HCIPacket{Dst: ind.Dst(), ID: ind.ID(), Payload: append([]byte{wimod.LORAWAN_STATUS_OK, 0x00, 0x01}, bytes.Repeat([]byte{0xAA}, 32)...)}
+	frame := slip.SlipEncode(packet.Encode())
+	b.ReportAllocs()
+	b.ResetTimer()
+	go func() {
+		for i := 0; i < b.N; i++ {
+			stream.modem.Write(frame)
+		}
+	}()
+	for i := 0; i < b.N; i++ {
+		<-sub.C()
+	}
+}
+
+func TestCRCEngine(t *testing.T) {
+	check := []byte("123456789")
+	h := crc.New16()
+	h.Write(check[:4])
+	h.Write(check[4:])
+	if h.Sum16() != 0x906E || crc.CalcCRC16(check) != 0x906E || !bytes.Equal(h.Sum(nil), []byte{0x90, 0x6E}) {
+		t.Fatalf("Unexpected CRC16 %04X", h.Sum16())
+	}
+	for _, c := range []struct {
+		params   crc.Params
+		expected uint64
+	}{
+		{crc.CRC16_HCI, 0x906E},
+		{crc.CRC32_IEEE, 0xCBF43926},
+		{crc.Params{Width: 16, Poly: 0x1021, Init: 0xFFFF}, 0x29B1},
+		{crc.Params{Width: 8, Poly: 0x07}, 0xF4},
+	} {
+		table, err := crc.MakeTable(c.params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sum := table.Checksum(check); sum != c.expected {
+			t.Fatalf("Expected %X, got %X for %+v", c.expected, sum, c.params)
+		}
+		h := table.New()
+		h.Write(check)
+		if h.Sum64() != c.expected {
+			t.Fatalf("Expected %X, got %X for %+v", c.expected, h.Sum64(), c.params)
+		}
+	}
+}
+
+func TestShortPayload(t *testing.T) {
+	resp := wimod.NewGetDeviceStatusResp()
+	packet := hci.HCIPacket{Dst: resp.Dst(), ID: resp.ID(), Payload: []byte{wimod.DEVMGMT_STATUS_OK, 0x01, 0x02}}
+	err := wimod.DecodeResp(&packet, resp)
+	var shortErr *wimod.ShortPayloadError
+	if !errors.Is(err, wimod.ErrShortPayload) || !errors.As(err, &shortErr) {
+		t.Fatalf("Expected short payload error, got %v", err)
+	}
+	if shortErr.Code != wimod.DEVMGMT_MSG_GET_DEVICE_STATUS_RSP || shortErr.Expected != 60 || shortErr.Actual != 3 {
+		t.Fatalf("Unexpected error %+v", shortErr)
+	}
+	if err := packet.Decode([]byte{0xFF, 0xFF}); err == nil {
+		t.Fatal("Expected short HCI packet error")
+	}
+}
+
+func FuzzHCIDecode(f *testing.F) {
+	ping := wimod.NewPingResp()
+	packet := hci.HCIPacket{Dst: ping.Dst(), ID: ping.ID(), Payload: []byte{wimod.DEVMGMT_STATUS_OK}}
+	f.Add(packet.Encode())
+	f.Add([]byte{})
+	f.Add([]byte{0xFF, 0xFF})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		packet := hci.HCIPacket{}
+		if packet.Decode(data) == nil && !bytes.Equal(packet.Encode(), data) {
+			t.Fatalf("Decoded %X as %v", data, packet)
+		}
+	})
+}
+
+func FuzzDecodeInd(f *testing.F) {
+	for _, ind := range []wimod.WiModMessageInd{
+		wimod.NewRTCAlarmInd(), wimod.NewJoinNetworkTxInd(), wimod.NewJoinNetworkInd(),
+		wimod.NewSendUDataTxInd(), wimod.NewRecvUDataInd(), wimod.NewSendCDataTxInd(),
+		wimod.NewRecvCDataInd(), wimod.NewRecvAckInd(), wimod.NewRecvNoDataInd(), wimod.NewRecvMACCmdInd(),
+	} {
+		f.Add(ind.Dst(), ind.ID(), []byte{})
+		f.Add(ind.Dst(), ind.ID(), []byte{0xFF})
+	}
+	f.Fuzz(func(t *testing.T, dst byte, id byte, payload []byte) {
+		wimod.DecodeInd(&hci.HCIPacket{Dst: dst, ID: id, Payload: payload})
+	})
+}
+
+func TestStatusError(t *testing.T) {
+	stream := newPipeStream()
+	c := controller.NewController(&controller.WiModControllerConfig{Stream: stream})
+	defer c.Close()
+	rpcServer := rpc.NewServer()
+	rpcServer.Register(&server.WimodServer{Controller: c})
+	serverConn, clientConn := net.Pipe()
+	go rpcServer.ServeConn(serverConn)
+	wimodClient := &client.WimodClient{Client: rpc.NewClient(clientConn)}
+	defer wimodClient.Client.Close()
+	resp := wimod.NewSendUDataResp()
+	stream.replies <- hci.HCIPacket{Dst: resp.Dst(), ID: resp.ID(), Payload: []byte{wimod.LORAWAN_STATUS_CHANNEL_BLOCKED, 0xE8, 0x03, 0x00, 0x00}}
+	_, err := wimodClient.SendUData(1, []byte{0x01})
+	var statusErr *wimod.StatusError
+	if !errors.Is(err, wimod.ErrChannelBlocked) || !errors.As(err, &statusErr) {
+		t.Fatalf("Expected channel blocked, got %v", err)
+	}
+	if statusErr.MessageCode != wimod.LORAWAN_MSG_SEND_UDATA_RSP || statusErr.RemainingTime != 1000 || errors.Is(err, wimod.ErrDeviceBusy) {
+		t.Fatalf("Unexpected error %+v", statusErr)
+	}
+	rstack := wimod.NewSetRStackConfigResp()
+	stream.replies <- hci.HCIPacket{Dst: rstack.Dst(), ID: rstack.ID(), Payload: []byte{wimod.LORAWAN_STATUS_WRONG_PARAMETER, wimod.LORAWAN_RSTACK_CONFIG_WRONG_BAND_INDEX}}
+	err = wimodClient.SetRStackConfig(wimod.RStackConfig{})
+	if !errors.Is(err, wimod.ErrLoRaWANWrongParameter) || !strings.HasSuffix(err.Error(), ": band index") {
+		t.Fatalf("Expected wrong parameter, got %v", err)
+	}
+}
+
+func TestRPCSubscription(t *testing.T) {
+	stream := newPipeStream()
+	c := controller.NewController(&controller.WiModControllerConfig{Stream: stream})
+	rpcServer := rpc.NewServer()
+	rpcServer.Register(&server.WimodServer{Controller: c})
+	serverConn, clientConn := net.Pipe()
+	go rpcServer.ServeConn(serverConn)
+	wimodClient := &client.WimodClient{Client: rpc.NewClient(clientConn)}
+	defer wimodClient.Client.Close()
+	sub, err := wimodClient.Subscribe(true, wimod.LORAWAN_MSG_RECV_UDATA_IND)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txInd, recv := wimod.NewSendUDataTxInd(), wimod.NewRecvUDataInd()
+	packets := []hci.HCIPacket{
+		{Dst: txInd.Dst(), ID: txInd.ID(), Payload: []byte{wimod.LORAWAN_MSG_SEND_UDATA_TX_IND_STATUS_OK}},
+		{Dst: recv.Dst(), ID: recv.ID(), Payload: []byte{0x01, 0x05, 0xAA}},
+		{Dst: recv.Dst(), ID: recv.ID(), Payload: []byte{0x00, 0x06, 0xBB}},
+	}
+	for _, packet := range packets {
+		stream.modem.Write(slip.SlipEncode(packet.Encode()))
+	}
+	ports := []byte{}
+	outcomes := 0
+	for i := 0; i < 3; i++ {
+		ind, outcome, err := sub.Next(time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case outcome != nil:
+			if outcome.Type != controller.RxOutcomeData || outcome.UplinkCode != wimod.LORAWAN_MSG_SEND_UDATA_TX_IND {
+				t.Fatalf("Unexpected outcome %v", outcome)
+			}
+			outcomes++
+		case ind != nil:
+			ports = append(ports, ind.(*wimod.RecvUDataInd).Port)
+		}
+	}
+	if outcomes != 1 || !bytes.Equal(ports, []byte{5, 6}) {
+		t.Fatalf("Expected one outcome and downlinks on ports 5 and 6, got %d and %v", outcomes, ports)
+	}
+	_, _, err = sub.Next(50 * time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline exceeded, got %v", err)
+	}
+	err = sub.Unsubscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = sub.Next(50 * time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "unknown subscription") {
+		t.Fatalf("Expected unknown subscription, got %v", err)
+	}
+	sub, err = wimodClient.Subscribe(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	_, _, err = sub.Next(time.Second)
+	if err == nil || !strings.Contains(err.Error(), controller.ErrClosed.Error()) {
+		t.Fatalf("Expected closed, got %v", err)
+	}
+}
+
+func TestSendCData(t *testing.T) {
+	payload, err := wimod.NewSendCDataReq(5, []byte{0xAA, 0xBB}).Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(payload, []byte{0x05, 0xAA, 0xBB}) {
+		t.Fatalf("Wrong payload encoded %X", payload)
+	}
+	resp := wimod.NewSendCDataResp()
+	err = resp.Decode([]byte{wimod.LORAWAN_STATUS_CHANNEL_BLOCKED, 0xE8, 0x03, 0x00, 0x00})
+	if !errors.Is(err, wimod.ErrChannelBlocked) || resp.RemainingTime != 1000 {
+		t.Fatalf("Expected channel blocked for 1000 ms, got %v, %d", err, resp.RemainingTime)
+	}
+	txInd := wimod.NewSendCDataTxInd()
+	err = txInd.Decode([]byte{wimod.LORAWAN_MSG_SEND_CDATA_TX_IND_STATUS_OK_ATTACHMENT, 0x02, 0x05, 0x03, 0x0E, 0x10, 0x27, 0x00, 0x00})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !txInd.Sent() || !txInd.Attached || txInd.ChannelIdx != 2 || txInd.DataRateIdx != 5 || txInd.NumTxPackets != 3 || txInd.TRXPowerLevel != 14 || txInd.RFMessageAirtime != 10000 {
+		t.Fatalf("Wrong tx indication decoded %v", txInd)
+	}
+	err = txInd.Decode([]byte{wimod.LORAWAN_MSG_SEND_CDATA_TX_IND_STATUS_MAX_RETRANSMISSIONS})
+	if !errors.Is(err, wimod.ErrMaxRetransmissions) || errors.Is(err, wimod.ErrLoRaWANCmdNotSupported) || txInd.Sent() {
+		t.Fatalf("Expected max retransmissions only, got %v, %v", err, txInd)
+	}
+	parsed, rest, ok := wimod.ParseStatusError(err.Error())
+	if !ok || rest != "" || !errors.Is(parsed, wimod.ErrMaxRetransmissions) {
+		t.Fatalf("Expected %v to parse back, got %v", err, parsed)
+	}
+	ack := wimod.NewRecvAckInd()
+	err = ack.Decode([]byte{0x01, 0x02, 0x05, 0xB5, 0x07, 0x01})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ack.Attached || ack.ChannelIdx != 2 || ack.DataRateIdx != 5 || ack.RSSI != -75 || ack.SNR != 7 || ack.RxSlot != 1 {
+		t.Fatalf("Wrong ack indication decoded %v", ack)
+	}
+}
+
+func TestSendAndAwaitAck(t *testing.T) {
+	stream := newPipeStream()
+	c := controller.NewController(&controller.WiModControllerConfig{Stream: stream})
+	defer c.Close()
+	rpcServer := rpc.NewServer()
+	rpcServer.Register(&server.WimodServer{Controller: c})
+	serverConn, clientConn := net.Pipe()
+	go rpcServer.ServeConn(serverConn)
+	wimodClient := &client.WimodClient{Client: rpc.NewClient(clientConn)}
+	defer wimodClient.Client.Close()
+	resp, txInd, ack := wimod.NewSendCDataResp(), wimod.NewSendCDataTxInd(), wimod.NewRecvAckInd()
+	respPacket := hci.HCIPacket{Dst: resp.Dst(), ID: resp.ID(), Payload: []byte{wimod.LORAWAN_STATUS_OK}}
+	// the indications follow the response right away, in the same write
+	stream.replies <- respPacket
+	stream.replies <- hci.HCIPacket{Dst: txInd.Dst(), ID: txInd.ID(), Payload: []byte{wimod.LORAWAN_MSG_SEND_CDATA_TX_IND_STATUS_OK}}
+	stream.replies <- hci.HCIPacket{Dst: ack.Dst(), ID: ack.ID(), Payload: []byte{0x00}}
+	acked, err := sendAndAwaitAck(wimodClient, 1, []byte{0x01}, time.Second)
+	if err != nil || !acked {
+		t.Fatalf("Expected acknowledged, got %t, %v", acked, err)
+	}
+	stream.replies <- respPacket
+	stream.replies <- hci.HCIPacket{Dst: txInd.Dst(), ID: txInd.ID(), Payload: []byte{wimod.LORAWAN_MSG_SEND_CDATA_TX_IND_STATUS_MAX_RETRANSMISSIONS}}
+	acked, err = sendAndAwaitAck(wimodClient, 1, []byte{0x01}, time.Second)
+	if err != nil || acked {
+		t.Fatalf("Expected not acknowledged, got %t, %v", acked, err)
+	}
+	stream.replies <- respPacket
+	stream.replies <- hci.HCIPacket{Dst: txInd.Dst(), ID: txInd.ID(), Payload: []byte{wimod.LORAWAN_MSG_SEND_CDATA_TX_IND_STATUS_MAX_PAYLOAD_SIZE}}
+	_, err = sendAndAwaitAck(wimodClient, 1, []byte{0x01}, time.Second)
+	if !errors.Is(err, wimod.ErrMaxPayloadSize) {
+		t.Fatalf("Expected max payload size, got %v", err)
+	}
+	stream.replies <- respPacket
+	stream.replies <- hci.HCIPacket{Dst: txInd.Dst(), ID: txInd.ID(), Payload: []byte{wimod.LORAWAN_MSG_SEND_CDATA_TX_IND_STATUS_OK}}
+	_, err = sendAndAwaitAck(wimodClient, 1, []byte{0x01}, 100*time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline exceeded, got %v", err)
+	}
+	stream.replies <- hci.HCIPacket{Dst: resp.Dst(), ID: resp.ID(), Payload: []byte{wimod.LORAWAN_STATUS_DEVICE_NOT_ACTIVATED}}
+	_, err = sendAndAwaitAck(wimodClient, 1, []byte{0x01}, time.Second)
+	if !errors.Is(err, wimod.ErrDeviceNotActivated) {
+		t.Fatalf("Expected device not activated, got %v", err)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	lorawan := func(code byte) error {
+		return &wimod.StatusError{Endpoint: wimod.LORAWAN_ID, Code: code, MessageCode: wimod.LORAWAN_MSG_SEND_UDATA_RSP}
+	}
+	cases := []struct {
+		err  error
+		code int
+	}{
+		{errors.New("local"), 1},
+		{&wimod.StatusError{Endpoint: wimod.DEVMGMT_ID, Code: wimod.DEVMGMT_STATUS_ERROR, MessageCode: wimod.DEVMGMT_MSG_PING_RSP}, 11},
+		{&wimod.StatusError{Endpoint: wimod.DEVMGMT_ID, Code: wimod.DEVMGMT_STATUS_CMD_NOT_SUPPORTED, MessageCode: wimod.DEVMGMT_MSG_PING_RSP}, 12},
+		{&wimod.StatusError{Endpoint: wimod.DEVMGMT_ID, Code: wimod.DEVMGMT_STATUS_WRONG_PARAMETER, MessageCode: wimod.DEVMGMT_MSG_PING_RSP}, 13},
+		{lorawan(wimod.LORAWAN_STATUS_ERROR), 11},
+		{lorawan(wimod.LORAWAN_STATUS_CMD_NOT_SUPPORTED), 12},
+		{lorawan(wimod.LORAWAN_STATUS_WRONG_PARAMETER), 13},
+		{lorawan(wimod.LORAWAN_STATUS_WRONG_DEVICE_MODE), 14},
+		{lorawan(wimod.LORAWAN_STATUS_DEVICE_NOT_ACTIVATED), 15},
+		{lorawan(wimod.LORAWAN_STATUS_DEVICE_BUSY), 16},
+		{lorawan(wimod.LORAWAN_STATUS_QUEUE_FULL), 17},
+		{lorawan(wimod.LORAWAN_STATUS_LENGTH_ERROR), 18},
+		{lorawan(wimod.LORAWAN_STATUS_NO_FACTORY_SETTINGS), 19},
+		{lorawan(wimod.LORAWAN_STATUS_CHANNEL_BLOCKED), 20},
+		{fmt.Errorf("confirmed data rejected: %w", lorawan(wimod.LORAWAN_STATUS_CHANNEL_NOT_AVAILABLE)), 21},
+		{lorawan(0x7F), 10},
+		{wimod.NewSendUDataTxInd().Decode([]byte{0x05}), 10},
+	}
+	for _, c := range cases {
+		if code := exitCode(c.err); code != c.code {
+			t.Errorf("Expected exit code %d for %v, got %d", c.code, c.err, code)
+		}
+	}
+	err := wimod.NewSendUDataTxInd().Decode([]byte{0x05})
+	if !errors.Is(err, wimod.ErrSendUDataTxError) || errors.Is(err, wimod.ErrLoRaWANCmdNotSupported) {
+		t.Fatalf("Expected send udata tx error only, got %v", err)
+	}
+	parsed, rest, ok := wimod.ParseStatusError(err.Error())
+	if !ok || rest != "" || !errors.Is(parsed, wimod.ErrSendUDataTxError) {
+		t.Fatalf("Expected %v to parse back, got %v", err, parsed)
+	}
+}
+
+func TestLinkADRReqConfig(t *testing.T) {
+	for name, option := range linkADROptions {
+		payload, err := wimod.NewSetLinkADRReqConfigReq(option).Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(payload, []byte{option}) {
+			t.Fatalf("Wrong payload encoded for %s: %X", name, payload)
+		}
+		resp := wimod.NewGetLinkADRReqConfigResp()
+		err = resp.Decode([]byte{wimod.LORAWAN_STATUS_OK, option})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Option != option || linkADROptionString(resp.Option) == "Unknown" {
+			t.Fatalf("Wrong option decoded for %s: %v", name, resp)
+		}
+	}
+	err := wimod.NewSetLinkADRReqConfigResp().Decode([]byte{wimod.LORAWAN_STATUS_WRONG_PARAMETER})
+	if !errors.Is(err, wimod.ErrLoRaWANWrongParameter) {
+		t.Fatalf("Expected wrong parameter, got %v", err)
+	}
+	err = wimod.NewGetLinkADRReqConfigResp().Decode([]byte{wimod.LORAWAN_STATUS_OK})
+	if !errors.Is(err, wimod.ErrShortPayload) {
+		t.Fatalf("Expected short payload, got %v", err)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/enolgor/wimod-lorawan-endnode-controller/controller"
+	"github.com/enolgor/wimod-lorawan-endnode-controller/wimod"
+)
+
+var provisionCommand = flag.NewFlagSet("provision", flag.ExitOnError)
+
+var provisionCSV string
+
+const (
+	provisionCSVFlag        = "csv"
+	defaultProvisionCSVFlag = ""
+	provisionCSVUsage       = "CSV file with DevEUI,AppEUI,AppKey rows, one per device"
+)
+
+var provisionSerialPorts string
+
+const (
+	provisionSerialPortsFlag        = "serialports"
+	defaultProvisionSerialPortsFlag = ""
+	provisionSerialPortsUsage       = "Comma separated serial ports of the attached devices, matched in order with the CSV rows"
+)
+
+var provisionReport string
+
+const (
+	provisionReportFlag        = "report"
+	defaultProvisionReportFlag = ""
+	provisionReportUsage       = "Write the per-device report to this file instead of stdout"
+)
+
+const provisionRestartDelay = 2 * time.Second
+
+func init() {
+	provisionCommand.StringVar(&provisionCSV, provisionCSVFlag, defaultProvisionCSVFlag, provisionCSVUsage)
+	provisionCommand.StringVar(&provisionSerialPorts, provisionSerialPortsFlag, defaultProvisionSerialPortsFlag, provisionSerialPortsUsage)
+	provisionCommand.StringVar(&provisionReport, provisionReportFlag, defaultProvisionReportFlag, provisionReportUsage)
+}
+
+type provisionEntry struct {
+	devEUI wimod.EUI
+	appEUI wimod.EUI
+	appKey wimod.Key
+}
+
+type provisionResult struct {
+	port       string
+	devEUI     wimod.EUI
+	err        error
+	firmware   string
+	moduleType string
+}
+
+func runProvisionCommand() {
+	if provisionCSV == "" || provisionSerialPorts == "" {
+		fmt.Fprintln(os.Stderr, "csv and serialports must be specified")
+		printDefaults(provisionCommand)
+		os.Exit(1)
+	}
+	entries, err := readProvisionCSV(provisionCSV)
+	if err != nil {
+		printErrorAndExit(err)
+	}
+	ports := strings.Split(provisionSerialPorts, ",")
+	if len(entries) < len(ports) {
+		printErrorAndExit(fmt.Errorf("%d serial ports given but only %d CSV rows", len(ports), len(entries)))
+	}
+	out := os.Stdout
+	if provisionReport != "" {
+		out, err = os.Create(provisionReport)
+		if err != nil {
+			printErrorAndExit(err)
+		}
+		defer out.Close()
+	}
+	report := csv.NewWriter(out)
+	report.Write([]string{"SerialPort", "DevEUI", "Success", "Error", "Firmware", "ModuleType"})
+	failed := 0
+	for i, port := range ports {
+		port = strings.TrimSpace(port)
+		result := provisionDevice(port, entries[i])
+		errStr := ""
+		if result.err != nil {
+			errStr = result.err.Error()
+			failed++
+		}
+		report.Write([]string{port, result.devEUI.String(), fmt.Sprintf("%t", result.err == nil), errStr, result.firmware, result.moduleType})
+		report.Flush()
+	}
+	unassigned := entries[len(ports):]
+	for _, entry := range unassigned {
+		report.Write([]string{"", entry.devEUI.String(), "false", "not provisioned, no serial port left for this row", "", ""})
+	}
+	report.Flush()
+	if err := report.Error(); err != nil {
+		printErrorAndExit(err)
+	}
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d devices failed to provision\n", failed, len(ports))
+	}
+	if len(unassigned) > 0 {
+		fmt.Fprintf(os.Stderr, "%d CSV rows not provisioned, only %d serial ports given\n", len(unassigned), len(ports))
+	}
+	if failed > 0 || len(unassigned) > 0 {
+		os.Exit(1)
+	}
+}
+
+func readProvisionCSV(path string) ([]provisionEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = 3
+	reader.TrimLeadingSpace = true
+	entries := []provisionEntry{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if line == 1 && strings.EqualFold(record[0], "deveui") {
+			continue
+		}
+		devEUI, err := wimod.ParseEUI(record[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: DevEUI: %s", line, err.Error())
+		}
+		appEUI, err := wimod.ParseEUI(record[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: AppEUI: %s", line, err.Error())
+		}
+		appKey, err := wimod.ParseKey(record[2])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: AppKey: %s", line, err.Error())
+		}
+		entries = append(entries, provisionEntry{devEUI, appEUI, appKey})
+	}
+	return entries, nil
+}
+
+func provisionDevice(port string, entry provisionEntry) provisionResult {
+	result := provisionResult{port: port, devEUI: entry.devEUI}
+	c, err := openController(port)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	defer c.Close()
+	result.err = programDevice(c, entry)
+	infoResp := wimod.NewGetDeviceInfoResp()
+	if err := c.Request(wimod.NewGetDeviceInfoReq(), infoResp); err == nil {
+		result.moduleType = moduleTypeString(infoResp.ModuleType)
+	}
+	fwResp := wimod.NewGetFWInfoResp()
+	if err := c.Request(wimod.NewGetFWInfoReq(), fwResp); err == nil {
+		result.firmware = fmt.Sprintf("%d.%d.%d", fwResp.MajorVersion, fwResp.MinorVersion, fwResp.Build)
+	}
+	return result
+}
+
+func programDevice(c *controller.WiModController, entry provisionEntry) error {
+	err := c.Request(wimod.NewFactoryResetReq(), wimod.NewFactoryResetResp())
+	if err != nil {
+		return fmt.Errorf("factory reset: %w", err)
+	}
+	time.Sleep(provisionRestartDelay)
+	err = c.Request(wimod.NewSetOPModeReq(wimod.DEVMGMT_OPMODE_CUSTOMER), wimod.NewSetOPModeResp())
+	if err != nil {
+		return fmt.Errorf("customer mode: %w", err)
+	}
+	time.Sleep(provisionRestartDelay)
+	err = c.Request(wimod.NewSetDeviceEUIReq(entry.devEUI), wimod.NewSetDeviceEUIResp())
+	if err != nil {
+		return fmt.Errorf("set device EUI: %w", err)
+	}
+	err = c.Request(wimod.NewSetJoinParamReq(entry.appEUI, entry.appKey), wimod.NewSetJoinParamResp())
+	if err != nil {
+		return fmt.Errorf("set join parameters: %w", err)
+	}
+	err = c.Request(wimod.NewSetOPModeReq(wimod.DEVMGMT_OPMODE_STANDARD), wimod.NewSetOPModeResp())
+	if err != nil {
+		return fmt.Errorf("standard mode: %w", err)
+	}
+	time.Sleep(provisionRestartDelay)
+	euiResp := wimod.NewGetDeviceEUIResp()
+	err = c.Request(wimod.NewGetDeviceEUIReq(), euiResp)
+	if err != nil {
+		return fmt.Errorf("verify device EUI: %w", err)
+	}
+	if euiResp.EUI != entry.devEUI {
+		return fmt.Errorf("verify device EUI: device reports %v", euiResp.EUI)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package region
+
+// Only the band indices of the default EU firmware are known, the other
+// firmwares number their bands in their own regional HCI specification, so
+// their bands are left unknown rather than guessed.
+const (
+	BAND_EU868         byte = 1
+	BAND_IN865         byte = 2
+	BAND_EU868_RX2_SF9 byte = 129
+	BAND_IN865_RX2_SF8 byte = 130
+)
+
+var eu868DataRates = map[byte]DataRate{
+	0: {SF: 12, BandwidthKHz: 125, Bitrate: 250, MaxPayload: 51},
+	1: {SF: 11, BandwidthKHz: 125, Bitrate: 440, MaxPayload: 51},
+	2: {SF: 10, BandwidthKHz: 125, Bitrate: 980, MaxPayload: 51},
+	3: {SF: 9, BandwidthKHz: 125, Bitrate: 1760, MaxPayload: 115},
+	4: {SF: 8, BandwidthKHz: 125, Bitrate: 3125, MaxPayload: 222},
+	5: {SF: 7, BandwidthKHz: 125, Bitrate: 5470, MaxPayload: 222},
+	6: {SF: 7, BandwidthKHz: 250, Bitrate: 11000, MaxPayload: 222},
+	7: {FSK: true, Bitrate: 50000, MaxPayload: 222},
+}
+
+var in865DataRates = map[byte]DataRate{
+	0: {SF: 12, BandwidthKHz: 125, Bitrate: 250, MaxPayload: 51},
+	1: {SF: 11, BandwidthKHz: 125, Bitrate: 440, MaxPayload: 51},
+	2: {SF: 10, BandwidthKHz: 125, Bitrate: 980, MaxPayload: 51},
+	3: {SF: 9, BandwidthKHz: 125, Bitrate: 1760, MaxPayload: 115},
+	4: {SF: 8, BandwidthKHz: 125, Bitrate: 3125, MaxPayload: 222},
+	5: {SF: 7, BandwidthKHz: 125, Bitrate: 5470, MaxPayload: 222},
+	7: {FSK: true, Bitrate: 50000, MaxPayload: 222},
+}
+
+var bands = map[byte]*Band{
+	BAND_EU868: {
+		Index:     BAND_EU868,
+		Name:      "EU868",
+		DataRates: eu868DataRates,
+		Channels:  []uint32{868100000, 868300000, 868500000},
+	},
+	BAND_IN865: {
+		Index:     BAND_IN865,
+		Name:      "IN865",
+		DataRates: in865DataRates,
+		Channels:  []uint32{865062500, 865402500, 865985000},
+	},
+	BAND_EU868_RX2_SF9: {
+		Index:     BAND_EU868_RX2_SF9,
+		Name:      "EU868 (RX2 SF9)",
+		DataRates: eu868DataRates,
+		Channels:  []uint32{868100000, 868300000, 868500000},
+	},
+	BAND_IN865_RX2_SF8: {
+		Index:     BAND_IN865_RX2_SF8,
+		Name:      "IN865 (RX2 SF8)",
+		DataRates: in865DataRates,
+		Channels:  []uint32{865062500, 865402500, 865985000},
+	},
+}
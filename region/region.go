@@ -0,0 +1,67 @@
+package region
+
+import "fmt"
+
+type DataRate struct {
+	FSK          bool
+	SF           byte
+	BandwidthKHz uint
+	Bitrate      uint
+	MaxPayload   byte
+}
+
+func (d DataRate) String() string {
+	if d.FSK {
+		return fmt.Sprintf("FSK %dK, -, %dbps", d.Bitrate/1000, d.Bitrate)
+	}
+	return fmt.Sprintf("LoRa SF%d, %dkHz, %dbps", d.SF, d.BandwidthKHz, d.Bitrate)
+}
+
+type Band struct {
+	Index     byte
+	Name      string
+	DataRates map[byte]DataRate
+	Channels  []uint32
+}
+
+func (b *Band) String() string {
+	return b.Name
+}
+
+func (b *Band) DataRate(idx byte) (DataRate, bool) {
+	dr, ok := b.DataRates[idx]
+	return dr, ok
+}
+
+func (b *Band) ChannelFrequency(idx byte) (uint32, bool) {
+	if int(idx) >= len(b.Channels) {
+		return 0, false
+	}
+	return b.Channels[idx], true
+}
+
+func (b *Band) DataRateString(idx byte) string {
+	if dr, ok := b.DataRate(idx); ok {
+		return dr.String()
+	}
+	return "Unknown Data Rate"
+}
+
+func (b *Band) ChannelString(idx byte) string {
+	if freq, ok := b.ChannelFrequency(idx); ok {
+		return fmt.Sprintf("%.3f MHz", float64(freq)/1e6)
+	}
+	return "network defined"
+}
+
+func Lookup(bandIdx byte) (*Band, bool) {
+	band, ok := bands[bandIdx]
+	return band, ok
+}
+
+func Name(bandIdx byte) string {
+	if band, ok := bands[bandIdx]; ok {
+		return band.Name
+	}
+	return "Unknown Band"
+}
@@ -1,9 +1,12 @@
 package client
 
 import (
+	"fmt"
 	"net/rpc"
 	"time"
 
+	"github.com/enolgor/wimod-lorawan-endnode-controller/controller"
+	"github.com/enolgor/wimod-lorawan-endnode-controller/mac"
 	"github.com/enolgor/wimod-lorawan-endnode-controller/wimod"
 )
 
@@ -11,18 +14,33 @@ type WimodClient struct {
 	Client *rpc.Client
 }
 
+// call turns the status errors of the modem, that net/rpc hands over as plain
+// text, back into *wimod.StatusError.
+func (c *WimodClient) call(serviceMethod string, args any, reply any) error {
+	err := c.Client.Call(serviceMethod, args, reply)
+	if serverErr, ok := err.(rpc.ServerError); ok {
+		if statusErr, rest, ok := wimod.ParseStatusError(string(serverErr)); ok {
+			if rest == "" {
+				return statusErr
+			}
+			return fmt.Errorf("%w%s", statusErr, rest)
+		}
+	}
+	return err
+}
+
 // Ping
 
 func (c *WimodClient) Ping() error {
 	resp := 0
-	return c.Client.Call("WimodServer.Ping", 0, &resp)
+	return c.call("WimodServer.Ping", 0, &resp)
 }
 
 // GetDeviceInfo
 
 func (c *WimodClient) GetDeviceInfo() (*wimod.GetDeviceInfoResp, error) {
 	resp := wimod.NewGetDeviceInfoResp()
-	err := c.Client.Call("WimodServer.GetDeviceInfo", 0, resp)
+	err := c.call("WimodServer.GetDeviceInfo", 0, resp)
 	return resp, err
 }
 
@@ -30,7 +48,7 @@ func (c *WimodClient) GetDeviceInfo() (*wimod.GetDeviceInfoResp, error) {
 
 func (c *WimodClient) GetFWInfo() (*wimod.GetFWInfoResp, error) {
 	resp := wimod.NewGetFWInfoResp()
-	err := c.Client.Call("WimodServer.GetFWInfo", 0, resp)
+	err := c.call("WimodServer.GetFWInfo", 0, resp)
 	return resp, err
 }
 
@@ -38,21 +56,21 @@ func (c *WimodClient) GetFWInfo() (*wimod.GetFWInfoResp, error) {
 
 func (c *WimodClient) Reset() error {
 	resp := 0
-	return c.Client.Call("WimodServer.Reset", 0, &resp)
+	return c.call("WimodServer.Reset", 0, &resp)
 }
 
 // SetOPMode
 
 func (c *WimodClient) SetOPMode(mode byte) error {
 	resp := 0
-	return c.Client.Call("WimodServer.SetOPMode", wimod.NewSetOPModeReq(mode), &resp)
+	return c.call("WimodServer.SetOPMode", wimod.NewSetOPModeReq(mode), &resp)
 }
 
 // GetOPMode
 
 func (c *WimodClient) GetOPMode() (*wimod.GetOPModeResp, error) {
 	resp := wimod.NewGetOPModeResp()
-	err := c.Client.Call("WimodServer.GetOPMode", 0, resp)
+	err := c.call("WimodServer.GetOPMode", 0, resp)
 	return resp, err
 }
 
@@ -60,14 +78,14 @@ func (c *WimodClient) GetOPMode() (*wimod.GetOPModeResp, error) {
 
 func (c *WimodClient) SetRTC(time time.Time) error {
 	resp := 0
-	return c.Client.Call("WimodServer.SetRTC", wimod.NewSetRTCReq(time), &resp)
+	return c.call("WimodServer.SetRTC", wimod.NewSetRTCReq(time), &resp)
 }
 
 // GetRTC
 
 func (c *WimodClient) GetRTC() (*wimod.GetRTCResp, error) {
 	resp := wimod.NewGetRTCResp()
-	err := c.Client.Call("WimodServer.GetRTC", 0, resp)
+	err := c.call("WimodServer.GetRTC", 0, resp)
 	return resp, err
 }
 
@@ -75,7 +93,7 @@ func (c *WimodClient) GetRTC() (*wimod.GetRTCResp, error) {
 
 func (c *WimodClient) GetDeviceStatus() (*wimod.GetDeviceStatusResp, error) {
 	resp := wimod.NewGetDeviceStatusResp()
-	err := c.Client.Call("WimodServer.GetDeviceStatus", 0, resp)
+	err := c.call("WimodServer.GetDeviceStatus", 0, resp)
 	return resp, err
 }
 
@@ -83,21 +101,21 @@ func (c *WimodClient) GetDeviceStatus() (*wimod.GetDeviceStatusResp, error) {
 
 func (c *WimodClient) SetRTCAlarm(alarmType, hour, minutes, seconds byte) error {
 	resp := 0
-	return c.Client.Call("WimodServer.SetRTCAlarm", wimod.NewSetRTCAlarmReq(alarmType, hour, minutes, seconds), &resp)
+	return c.call("WimodServer.SetRTCAlarm", wimod.NewSetRTCAlarmReq(alarmType, hour, minutes, seconds), &resp)
 }
 
 // ClearRTCAlarm
 
 func (c *WimodClient) ClearRTCAlarm() error {
 	resp := 0
-	return c.Client.Call("WimodServer.ClearRTCAlarm", 0, &resp)
+	return c.call("WimodServer.ClearRTCAlarm", 0, &resp)
 }
 
 // GetRTCAlarm
 
 func (c *WimodClient) GetRTCAlarm() (*wimod.GetRTCAlarmResp, error) {
 	resp := wimod.NewGetRTCAlarmResp()
-	err := c.Client.Call("WimodServer.GetRTCAlarm", 0, resp)
+	err := c.call("WimodServer.GetRTCAlarm", 0, resp)
 	return resp, err
 }
 
@@ -105,7 +123,7 @@ func (c *WimodClient) GetRTCAlarm() (*wimod.GetRTCAlarmResp, error) {
 
 func (c *WimodClient) RTCAlarmInd() (*wimod.RTCAlarmInd, error) {
 	ind := wimod.NewRTCAlarmInd()
-	err := c.Client.Call("WimodServer.RTCAlarmInd", 0, ind)
+	err := c.call("WimodServer.RTCAlarmInd", 0, ind)
 	return ind, err
 }
 
@@ -113,28 +131,28 @@ func (c *WimodClient) RTCAlarmInd() (*wimod.RTCAlarmInd, error) {
 
 func (c *WimodClient) ActivateDevice(address uint32, appSessKey wimod.Key, nwkSessKey wimod.Key) error {
 	resp := 0
-	return c.Client.Call("WimodServer.ActivateDevice", wimod.NewActivateDeviceReq(address, appSessKey, nwkSessKey), &resp)
+	return c.call("WimodServer.ActivateDevice", wimod.NewActivateDeviceReq(address, appSessKey, nwkSessKey), &resp)
 }
 
 // SetJoinParam
 
 func (c *WimodClient) SetJoinParam(appEUI wimod.EUI, appKey wimod.Key) error {
 	resp := 0
-	return c.Client.Call("WimodServer.SetJoinParam", wimod.NewSetJoinParamReq(appEUI, appKey), &resp)
+	return c.call("WimodServer.SetJoinParam", wimod.NewSetJoinParamReq(appEUI, appKey), &resp)
 }
 
 // JoinNetwork
 
 func (c *WimodClient) JoinNetwork() error {
 	resp := 0
-	return c.Client.Call("WimodServer.JoinNetwork", 0, &resp)
+	return c.call("WimodServer.JoinNetwork", 0, &resp)
 }
 
 // JoinNetworkTxInd
 
 func (c *WimodClient) JoinNetworkTxInd() (*wimod.JoinNetworkTxInd, error) {
 	ind := wimod.NewJoinNetworkTxInd()
-	err := c.Client.Call("WimodServer.JoinNetworkTxInd", 0, ind)
+	err := c.call("WimodServer.JoinNetworkTxInd", 0, ind)
 	return ind, err
 }
 
@@ -142,15 +160,23 @@ func (c *WimodClient) JoinNetworkTxInd() (*wimod.JoinNetworkTxInd, error) {
 
 func (c *WimodClient) JoinNetworkInd() (*wimod.JoinNetworkInd, error) {
 	ind := wimod.NewJoinNetworkInd()
-	err := c.Client.Call("WimodServer.JoinNetworkInd", 0, ind)
+	err := c.call("WimodServer.JoinNetworkInd", 0, ind)
 	return ind, err
 }
 
+// JoinNetworkTransaction
+
+func (c *WimodClient) JoinNetworkTransaction() (*controller.JoinNetworkResult, error) {
+	result := &controller.JoinNetworkResult{}
+	err := c.call("WimodServer.JoinNetworkTransaction", 0, result)
+	return result, err
+}
+
 // SendUData
 
 func (c *WimodClient) SendUData(port byte, payload []byte) (*wimod.SendUDataResp, error) {
 	resp := wimod.NewSendUDataResp()
-	err := c.Client.Call("WimodServer.SendUData", wimod.NewSendUDataReq(port, payload), resp)
+	err := c.call("WimodServer.SendUData", wimod.NewSendUDataReq(port, payload), resp)
 	return resp, err
 }
 
@@ -158,26 +184,86 @@ func (c *WimodClient) SendUData(port byte, payload []byte) (*wimod.SendUDataResp
 
 func (c *WimodClient) SendUDataTxInd() (*wimod.SendUDataTxInd, error) {
 	ind := wimod.NewSendUDataTxInd()
-	err := c.Client.Call("WimodServer.SendUDataTxInd", 0, ind)
+	err := c.call("WimodServer.SendUDataTxInd", 0, ind)
+	return ind, err
+}
+
+// SendUDataTransaction
+
+func (c *WimodClient) SendUDataTransaction(port byte, payload []byte) (*controller.SendUDataResult, error) {
+	result := &controller.SendUDataResult{}
+	err := c.call("WimodServer.SendUDataTransaction", wimod.NewSendUDataReq(port, payload), result)
+	return result, err
+}
+
+// RecvUDataInd
+
+func (c *WimodClient) RecvUDataInd() (*wimod.RecvUDataInd, error) {
+	ind := wimod.NewRecvUDataInd()
+	err := c.call("WimodServer.RecvUDataInd", 0, ind)
+	return ind, err
+}
+
+// SendCData
+
+func (c *WimodClient) SendCData(port byte, payload []byte) (*wimod.SendCDataResp, error) {
+	resp := wimod.NewSendCDataResp()
+	err := c.call("WimodServer.SendCData", wimod.NewSendCDataReq(port, payload), resp)
+	return resp, err
+}
+
+// SendCDataTxInd
+
+func (c *WimodClient) SendCDataTxInd() (*wimod.SendCDataTxInd, error) {
+	ind := wimod.NewSendCDataTxInd()
+	err := c.call("WimodServer.SendCDataTxInd", 0, ind)
+	return ind, err
+}
+
+// RecvCDataInd
+
+func (c *WimodClient) RecvCDataInd() (*wimod.RecvCDataInd, error) {
+	ind := wimod.NewRecvCDataInd()
+	err := c.call("WimodServer.RecvCDataInd", 0, ind)
+	return ind, err
+}
+
+// RecvAckInd
+
+func (c *WimodClient) RecvAckInd() (*wimod.RecvAckInd, error) {
+	ind := wimod.NewRecvAckInd()
+	err := c.call("WimodServer.RecvAckInd", 0, ind)
+	return ind, err
+}
+
+// RecvNoDataInd
+
+func (c *WimodClient) RecvNoDataInd() (*wimod.RecvNoDataInd, error) {
+	ind := wimod.NewRecvNoDataInd()
+	err := c.call("WimodServer.RecvNoDataInd", 0, ind)
 	return ind, err
 }
 
-// LORAWAN_MSG_RECV_UDATA_IND
-// LORAWAN_MSG_SEND_CDATA_REQ
-// LORAWAN_MSG_SEND_CDATA_RSP
-// LORAWAN_MSG_SEND_CDATA_TX_IND
-// LORAWAN_MSG_RECV_CDATA_IND
-// LORAWAN_MSG_RECV_ACK_IND
-// LORAWAN_MSG_RECV_NO_DATA_IND
-// LORAWAN_MSG_SET_RSTACK_CONFIG_REQ
-// LORAWAN_MSG_SET_RSTACK_CONFIG_RSP
-// LORAWAN_MSG_GET_RSTACK_CONFIG_REQ
+// RxOutcome
+
+func (c *WimodClient) RxOutcome() (*controller.RxOutcome, error) {
+	outcome := &controller.RxOutcome{}
+	err := c.call("WimodServer.RxOutcome", 0, outcome)
+	return outcome, err
+}
+
+// SetRStackConfig
+
+func (c *WimodClient) SetRStackConfig(config wimod.RStackConfig) error {
+	resp := 0
+	return c.call("WimodServer.SetRStackConfig", wimod.NewSetRStackConfigReq(config), &resp)
+}
 
 // GetRStackConfig
 
 func (c *WimodClient) GetRStackConfig() (*wimod.GetRStackConfigResp, error) {
 	resp := wimod.NewGetRStackConfigResp()
-	err := c.Client.Call("WimodServer.GetRStackConfig", 0, resp)
+	err := c.call("WimodServer.GetRStackConfig", 0, resp)
 	return resp, err
 }
 
@@ -185,7 +271,7 @@ func (c *WimodClient) GetRStackConfig() (*wimod.GetRStackConfigResp, error) {
 
 func (c *WimodClient) ReactivateDevice() (*wimod.ReactivateDeviceResp, error) {
 	resp := wimod.NewReactivateDeviceResp()
-	err := c.Client.Call("WimodServer.ReactivateDevice", 0, resp)
+	err := c.call("WimodServer.ReactivateDevice", 0, resp)
 	return resp, err
 }
 
@@ -193,20 +279,28 @@ func (c *WimodClient) ReactivateDevice() (*wimod.ReactivateDeviceResp, error) {
 
 func (c *WimodClient) DeactivateDevice() error {
 	resp := 0
-	return c.Client.Call("WimodServer.DeactivateDevice", 0, &resp)
+	return c.call("WimodServer.DeactivateDevice", 0, &resp)
 }
 
-// LORAWAN_MSG_FACTORY_RESET_REQ
-// LORAWAN_MSG_FACTORY_RESET_RSP
-// LORAWAN_MSG_SET_DEVICE_EUI_REQ
-// LORAWAN_MSG_SET_DEVICE_EUI_RSP
-// LORAWAN_MSG_GET_DEVICE_EUI_REQ
+// FactoryReset
+
+func (c *WimodClient) FactoryReset() error {
+	resp := 0
+	return c.call("WimodServer.FactoryReset", 0, &resp)
+}
+
+// SetDeviceEUI
+
+func (c *WimodClient) SetDeviceEUI(eui wimod.EUI) error {
+	resp := 0
+	return c.call("WimodServer.SetDeviceEUI", wimod.NewSetDeviceEUIReq(eui), &resp)
+}
 
 // GetDeviceEUI
 
 func (c *WimodClient) GetDeviceEUI() (*wimod.GetDeviceEUIResp, error) {
 	resp := wimod.NewGetDeviceEUIResp()
-	err := c.Client.Call("WimodServer.GetDeviceEUI", 0, resp)
+	err := c.call("WimodServer.GetDeviceEUI", 0, resp)
 	return resp, err
 }
 
@@ -214,20 +308,59 @@ func (c *WimodClient) GetDeviceEUI() (*wimod.GetDeviceEUIResp, error) {
 
 func (c *WimodClient) GetNwkStatus() (*wimod.GetNwkStatusResp, error) {
 	resp := wimod.NewGetNwkStatusResp()
-	err := c.Client.Call("WimodServer.GetNwkStatus", 0, resp)
+	err := c.call("WimodServer.GetNwkStatus", 0, resp)
+	return resp, err
+}
+
+// SendMACCmd
+
+func (c *WimodClient) SendMACCmd(confirmed bool, cmd mac.Command) error {
+	resp := 0
+	return c.call("WimodServer.SendMACCmd", wimod.NewSendMACCmdReq(confirmed, cmd), &resp)
+}
+
+// RecvMACCmdInd
+
+func (c *WimodClient) RecvMACCmdInd() (*wimod.RecvMACCmdInd, error) {
+	ind := wimod.NewRecvMACCmdInd()
+	err := c.call("WimodServer.RecvMACCmdInd", 0, ind)
+	return ind, err
+}
+
+// SetCustomCfg
+
+func (c *WimodClient) SetCustomCfg(rfGain int8) error {
+	resp := 0
+	return c.call("WimodServer.SetCustomCfg", wimod.NewSetCustomCfgReq(rfGain), &resp)
+}
+
+// GetCustomCfg
+
+func (c *WimodClient) GetCustomCfg() (*wimod.GetCustomCfgResp, error) {
+	resp := wimod.NewGetCustomCfgResp()
+	err := c.call("WimodServer.GetCustomCfg", 0, resp)
+	return resp, err
+}
+
+// GetSupportedBands
+
+func (c *WimodClient) GetSupportedBands() (*wimod.GetSupportedBandsResp, error) {
+	resp := wimod.NewGetSupportedBandsResp()
+	err := c.call("WimodServer.GetSupportedBands", 0, resp)
 	return resp, err
 }
 
-// LORAWAN_MSG_SEND_MAC_CMD_REQ
-// LORAWAN_MSG_SEND_MAC_CMD_RSP
-// LORAWAN_MSG_RECV_MAC_CMD_IND
-// LORAWAN_MSG_SET_CUSTOM_CFG_REQ
-// LORAWAN_MSG_SET_CUSTOM_CFG_RSP
-// LORAWAN_MSG_GET_CUSTOM_CFG_REQ
-// LORAWAN_MSG_GET_CUSTOM_CFG_RSP
-// LORAWAN_MSG_GET_SUPPORTED_BANDS_REQ
-// LORAWAN_MSG_GET_SUPPORTED_BANDS_RSP
-// LORAWAN_MSG_SET_LINKADRREQ_CONFIG_REQ
-// LORAWAN_MSG_SET_LINKADRREQ_CONFIG_RSP
-// LORAWAN_MSG_GET_LINKADRREQ_CONFIG_REQ
-// LORAWAN_MSG_GET_LINKADRREQ_CONFIG_RSP
+// SetLinkADRReqConfig
+
+func (c *WimodClient) SetLinkADRReqConfig(option byte) error {
+	resp := 0
+	return c.call("WimodServer.SetLinkADRReqConfig", wimod.NewSetLinkADRReqConfigReq(option), &resp)
+}
+
+// GetLinkADRReqConfig
+
+func (c *WimodClient) GetLinkADRReqConfig() (*wimod.GetLinkADRReqConfigResp, error) {
+	resp := wimod.NewGetLinkADRReqConfigResp()
+	err := c.call("WimodServer.GetLinkADRReqConfig", 0, resp)
+	return resp, err
+}
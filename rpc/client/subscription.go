@@ -0,0 +1,64 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/enolgor/wimod-lorawan-endnode-controller/controller"
+	"github.com/enolgor/wimod-lorawan-endnode-controller/rpc/server"
+	"github.com/enolgor/wimod-lorawan-endnode-controller/wimod"
+)
+
+// Subscription reads the events of a subscription kept by the server, which
+// buffers them between the calls to Next so none is lost while the client is
+// busy.
+type Subscription struct {
+	client *WimodClient
+	id     uint64
+}
+
+// Subscribe receives the indications with one of the given codes, or every
+// indication if no code is given, and the RX outcomes if rxOutcomes is set.
+func (c *WimodClient) Subscribe(rxOutcomes bool, codes ...uint16) (*Subscription, error) {
+	s := &Subscription{client: c}
+	err := c.call("WimodServer.Subscribe", &server.SubscribeArgs{Codes: codes, RxOutcomes: rxOutcomes}, &s.id)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Next waits up to timeout, or forever if it is zero, for the next event and
+// returns either its indication or its RX outcome. It fails with
+// context.DeadlineExceeded if the timeout expires, and with the *StatusError
+// of an indication reporting a failure, which is returned too.
+func (s *Subscription) Next(timeout time.Duration) (wimod.WiModMessageInd, *controller.RxOutcome, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		args := &server.NextArgs{ID: s.id}
+		if timeout > 0 {
+			args.Timeout = time.Until(deadline)
+			if args.Timeout <= 0 {
+				return nil, nil, fmt.Errorf("waiting for event: %w", context.DeadlineExceeded)
+			}
+		}
+		event := &server.Event{}
+		err := s.client.call("WimodServer.Next", args, event)
+		if err != nil {
+			return nil, nil, err
+		}
+		if event.Ind != nil {
+			ind, err := wimod.DecodeInd(event.Ind)
+			return ind, nil, err
+		}
+		if event.Outcome != nil {
+			return nil, event.Outcome, nil
+		}
+	}
+}
+
+func (s *Subscription) Unsubscribe() error {
+	resp := 0
+	return s.client.call("WimodServer.Unsubscribe", &s.id, &resp)
+}
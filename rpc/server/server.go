@@ -1,12 +1,17 @@
 package server
 
 import (
+	"sync"
+
 	"github.com/enolgor/wimod-lorawan-endnode-controller/controller"
 	"github.com/enolgor/wimod-lorawan-endnode-controller/wimod"
 )
 
 type WimodServer struct {
-	Controller *controller.WiModController
+	Controller         *controller.WiModController
+	mutex              sync.Mutex
+	subscriptions      map[uint64]*subscription
+	lastSubscriptionID uint64
 }
 
 // Ping
@@ -117,6 +122,12 @@ func (s *WimodServer) JoinNetworkInd(_ *int, ind *wimod.JoinNetworkInd) error {
 	return s.Controller.ReadSpecificInd(ind)
 }
 
+// JoinNetworkTransaction
+
+func (s *WimodServer) JoinNetworkTransaction(_ *int, result *controller.JoinNetworkResult) error {
+	return s.Controller.Transaction(wimod.NewJoinNetworkReq(), &result.Resp, &result.TxInd, &result.Ind)
+}
+
 // SendUData
 
 func (s *WimodServer) SendUData(request *wimod.SendUDataReq, response *wimod.SendUDataResp) error {
@@ -129,16 +140,61 @@ func (s *WimodServer) SendUDataTxInd(_ *int, ind *wimod.SendUDataTxInd) error {
 	return s.Controller.ReadSpecificInd(ind)
 }
 
-// LORAWAN_MSG_RECV_UDATA_IND
-// LORAWAN_MSG_SEND_CDATA_REQ
-// LORAWAN_MSG_SEND_CDATA_RSP
-// LORAWAN_MSG_SEND_CDATA_TX_IND
-// LORAWAN_MSG_RECV_CDATA_IND
-// LORAWAN_MSG_RECV_ACK_IND
-// LORAWAN_MSG_RECV_NO_DATA_IND
-// LORAWAN_MSG_SET_RSTACK_CONFIG_REQ
-// LORAWAN_MSG_SET_RSTACK_CONFIG_RSP
-// LORAWAN_MSG_GET_RSTACK_CONFIG_REQ
+// SendUDataTransaction
+
+func (s *WimodServer) SendUDataTransaction(request *wimod.SendUDataReq, result *controller.SendUDataResult) error {
+	return s.Controller.Transaction(request, &result.Resp, &result.TxInd)
+}
+
+// RecvUDataInd
+
+func (s *WimodServer) RecvUDataInd(_ *int, ind *wimod.RecvUDataInd) error {
+	return s.Controller.ReadSpecificInd(ind)
+}
+
+// SendCData
+
+func (s *WimodServer) SendCData(request *wimod.SendCDataReq, response *wimod.SendCDataResp) error {
+	return s.Controller.Request(request, response)
+}
+
+// SendCDataTxInd
+
+func (s *WimodServer) SendCDataTxInd(_ *int, ind *wimod.SendCDataTxInd) error {
+	return s.Controller.ReadSpecificInd(ind)
+}
+
+// RecvCDataInd
+
+func (s *WimodServer) RecvCDataInd(_ *int, ind *wimod.RecvCDataInd) error {
+	return s.Controller.ReadSpecificInd(ind)
+}
+
+// RecvAckInd
+
+func (s *WimodServer) RecvAckInd(_ *int, ind *wimod.RecvAckInd) error {
+	return s.Controller.ReadSpecificInd(ind)
+}
+
+// RecvNoDataInd
+
+func (s *WimodServer) RecvNoDataInd(_ *int, ind *wimod.RecvNoDataInd) error {
+	return s.Controller.ReadSpecificInd(ind)
+}
+
+// RxOutcome
+
+func (s *WimodServer) RxOutcome(_ *int, outcome *controller.RxOutcome) error {
+	var err error
+	*outcome, err = s.Controller.ReadRxOutcome()
+	return err
+}
+
+// SetRStackConfig
+
+func (s *WimodServer) SetRStackConfig(request *wimod.SetRStackConfigReq, _ *int) error {
+	return s.Controller.Request(request, wimod.NewSetRStackConfigResp())
+}
 
 // GetRStackConfig
 
@@ -158,11 +214,17 @@ func (s *WimodServer) DeactivateDevice(_ *int, _ *int) error {
 	return s.Controller.Request(wimod.NewDeactivateDeviceReq(), wimod.NewDeactivateDeviceResp())
 }
 
-// LORAWAN_MSG_FACTORY_RESET_REQ
-// LORAWAN_MSG_FACTORY_RESET_RSP
-// LORAWAN_MSG_SET_DEVICE_EUI_REQ
-// LORAWAN_MSG_SET_DEVICE_EUI_RSP
-// LORAWAN_MSG_GET_DEVICE_EUI_REQ
+// FactoryReset
+
+func (s *WimodServer) FactoryReset(_ *int, _ *int) error {
+	return s.Controller.Request(wimod.NewFactoryResetReq(), wimod.NewFactoryResetResp())
+}
+
+// SetDeviceEUI
+
+func (s *WimodServer) SetDeviceEUI(request *wimod.SetDeviceEUIReq, _ *int) error {
+	return s.Controller.Request(request, wimod.NewSetDeviceEUIResp())
+}
 
 // GetDeviceEUI
 
@@ -176,16 +238,44 @@ func (s *WimodServer) GetNwkStatus(_ *int, response *wimod.GetNwkStatusResp) err
 	return s.Controller.Request(wimod.NewGetNwkStatusReq(), response)
 }
 
-// LORAWAN_MSG_SEND_MAC_CMD_REQ
-// LORAWAN_MSG_SEND_MAC_CMD_RSP
-// LORAWAN_MSG_RECV_MAC_CMD_IND
-// LORAWAN_MSG_SET_CUSTOM_CFG_REQ
-// LORAWAN_MSG_SET_CUSTOM_CFG_RSP
-// LORAWAN_MSG_GET_CUSTOM_CFG_REQ
-// LORAWAN_MSG_GET_CUSTOM_CFG_RSP
-// LORAWAN_MSG_GET_SUPPORTED_BANDS_REQ
-// LORAWAN_MSG_GET_SUPPORTED_BANDS_RSP
-// LORAWAN_MSG_SET_LINKADRREQ_CONFIG_REQ
-// LORAWAN_MSG_SET_LINKADRREQ_CONFIG_RSP
-// LORAWAN_MSG_GET_LINKADRREQ_CONFIG_REQ
-// LORAWAN_MSG_GET_LINKADRREQ_CONFIG_RSP
+// SendMACCmd
+
+func (s *WimodServer) SendMACCmd(request *wimod.SendMACCmdReq, _ *int) error {
+	return s.Controller.Request(request, wimod.NewSendMACCmdResp())
+}
+
+// RecvMACCmdInd
+
+func (s *WimodServer) RecvMACCmdInd(_ *int, ind *wimod.RecvMACCmdInd) error {
+	return s.Controller.ReadSpecificInd(ind)
+}
+
+// SetCustomCfg
+
+func (s *WimodServer) SetCustomCfg(request *wimod.SetCustomCfgReq, _ *int) error {
+	return s.Controller.Request(request, wimod.NewSetCustomCfgResp())
+}
+
+// GetCustomCfg
+
+func (s *WimodServer) GetCustomCfg(_ *int, response *wimod.GetCustomCfgResp) error {
+	return s.Controller.Request(wimod.NewGetCustomCfgReq(), response)
+}
+
+// GetSupportedBands
+
+func (s *WimodServer) GetSupportedBands(_ *int, response *wimod.GetSupportedBandsResp) error {
+	return s.Controller.Request(wimod.NewGetSupportedBandsReq(), response)
+}
+
+// SetLinkADRReqConfig
+
+func (s *WimodServer) SetLinkADRReqConfig(request *wimod.SetLinkADRReqConfigReq, _ *int) error {
+	return s.Controller.Request(request, wimod.NewSetLinkADRReqConfigResp())
+}
+
+// GetLinkADRReqConfig
+
+func (s *WimodServer) GetLinkADRReqConfig(_ *int, response *wimod.GetLinkADRReqConfigResp) error {
+	return s.Controller.Request(wimod.NewGetLinkADRReqConfigReq(), response)
+}
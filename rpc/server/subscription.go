@@ -0,0 +1,160 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/enolgor/wimod-lorawan-endnode-controller/controller"
+	"github.com/enolgor/wimod-lorawan-endnode-controller/hci"
+)
+
+const (
+	subscriptionBufferSize  = 64
+	maxPollTimeout          = 30 * time.Second
+	subscriptionIdleTimeout = 2 * time.Minute
+)
+
+// SubscribeArgs selects the indications to receive, every one if Codes is
+// empty, and whether to receive the RX outcomes too.
+type SubscribeArgs struct {
+	Codes      []uint16
+	RxOutcomes bool
+}
+
+// NextArgs waits up to Timeout, capped to 30 seconds, for the next event of
+// the subscription ID.
+type NextArgs struct {
+	ID      uint64
+	Timeout time.Duration
+}
+
+// Event holds either an undecoded indication or an RX outcome, or neither if
+// none arrived in time.
+type Event struct {
+	Ind     *hci.HCIPacket
+	Outcome *controller.RxOutcome
+}
+
+// subscription buffers the events between the calls to Next, it is dropped if
+// Next is not called for subscriptionIdleTimeout.
+type subscription struct {
+	inds         <-chan hci.HCIPacket
+	stopInds     func()
+	outcomes     <-chan controller.RxOutcome
+	stopOutcomes func()
+	idle         *time.Timer
+	polling      int
+}
+
+func (s *subscription) stop() {
+	s.idle.Stop()
+	s.stopInds()
+	if s.stopOutcomes != nil {
+		s.stopOutcomes()
+	}
+}
+
+// Subscribe
+
+func (s *WimodServer) Subscribe(args *SubscribeArgs, id *uint64) error {
+	sub := &subscription{}
+	sub.inds, sub.stopInds = s.Controller.WatchIndications(subscriptionBufferSize, args.Codes...)
+	if args.RxOutcomes {
+		sub.outcomes, sub.stopOutcomes = s.Controller.WatchRxOutcomes()
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.subscriptions == nil {
+		s.subscriptions = make(map[uint64]*subscription)
+	}
+	s.lastSubscriptionID++
+	subscriptionID := s.lastSubscriptionID
+	s.subscriptions[subscriptionID] = sub
+	sub.idle = time.AfterFunc(subscriptionIdleTimeout, func() {
+		s.expire(subscriptionID)
+	})
+	*id = subscriptionID
+	return nil
+}
+
+// Next
+
+func (s *WimodServer) Next(args *NextArgs, event *Event) error {
+	s.mutex.Lock()
+	sub, ok := s.subscriptions[args.ID]
+	if ok {
+		sub.polling++
+	}
+	s.mutex.Unlock()
+	if !ok {
+		return unknownSubscription(args.ID)
+	}
+	defer func() {
+		s.mutex.Lock()
+		sub.polling--
+		if sub.polling == 0 {
+			sub.idle.Reset(subscriptionIdleTimeout)
+		}
+		s.mutex.Unlock()
+	}()
+	timeout := args.Timeout
+	if timeout <= 0 || timeout > maxPollTimeout {
+		timeout = maxPollTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case ind, ok := <-sub.inds:
+		if !ok {
+			return s.stoppedError(args.ID)
+		}
+		event.Ind = &ind
+	case outcome, ok := <-sub.outcomes:
+		if !ok {
+			return s.stoppedError(args.ID)
+		}
+		event.Outcome = &outcome
+	case <-timer.C:
+	}
+	return nil
+}
+
+// Unsubscribe
+
+func (s *WimodServer) Unsubscribe(id *uint64, _ *int) error {
+	s.mutex.Lock()
+	sub, ok := s.subscriptions[*id]
+	delete(s.subscriptions, *id)
+	s.mutex.Unlock()
+	if !ok {
+		return unknownSubscription(*id)
+	}
+	sub.stop()
+	return nil
+}
+
+// expire drops the subscription id unless it is being polled.
+func (s *WimodServer) expire(id uint64) {
+	s.mutex.Lock()
+	sub, ok := s.subscriptions[id]
+	if !ok || sub.polling > 0 {
+		s.mutex.Unlock()
+		return
+	}
+	delete(s.subscriptions, id)
+	s.mutex.Unlock()
+	sub.stop()
+}
+
+// stoppedError explains why the watchers of the subscription id were closed
+// while it was polled.
+func (s *WimodServer) stoppedError(id uint64) error {
+	if err := s.Controller.Err(); err != nil {
+		return err
+	}
+	return unknownSubscription(id)
+}
+
+func unknownSubscription(id uint64) error {
+	return fmt.Errorf("unknown subscription %d", id)
+}
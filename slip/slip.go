@@ -1,7 +1,9 @@
 package slip
 
 import (
-	"bytes"
+	"bufio"
+	"errors"
+	"fmt"
 	"io"
 )
 
@@ -13,7 +15,8 @@ const (
 )
 
 const (
-	BUFFER_SIZE = 128
+	BUFFER_SIZE            = 128
+	DEFAULT_MAX_FRAME_SIZE = 1024
 )
 
 const (
@@ -22,127 +25,209 @@ const (
 	SLIPDEC_STATE_ESC
 )
 
-type slipPacket struct {
-	Buffer bytes.Buffer
+var (
+	ErrInvalidEscape  = errors.New("slip: invalid escape sequence")
+	ErrFrameTooLarge  = errors.New("slip: frame too large")
+	ErrTruncatedFrame = errors.New("slip: truncated frame")
+)
+
+// FramingError reports a frame dropped by the decoder, Err is one of
+// ErrInvalidEscape, ErrFrameTooLarge or ErrTruncatedFrame and Length the
+// bytes of the frame decoded before the error.
+type FramingError struct {
 	Err    error
+	Length int
+}
+
+func (e *FramingError) Error() string {
+	return fmt.Sprintf("%s after %d bytes", e.Err, e.Length)
+}
+
+func (e *FramingError) Unwrap() error {
+	return e.Err
 }
 
 func SlipEncode(payload []byte) []byte {
-	var buff bytes.Buffer
-	buff.WriteByte(SLIP_END)
+	return appendFrame(make([]byte, 0, len(payload)+2), payload)
+}
+
+func appendFrame(buff []byte, payload []byte) []byte {
+	buff = append(buff, SLIP_END)
+	buff = appendEscaped(buff, payload)
+	return append(buff, SLIP_END)
+}
+
+func appendEscaped(buff []byte, payload []byte) []byte {
 	for _, b := range payload {
 		switch b {
 		case SLIP_END:
-			buff.WriteByte(SLIP_ESC)
-			buff.WriteByte(SLIP_ESC_END)
-			break
+			buff = append(buff, SLIP_ESC, SLIP_ESC_END)
 		case SLIP_ESC:
-			buff.WriteByte(SLIP_ESC)
-			buff.WriteByte(SLIP_ESC_ESC)
-			break
+			buff = append(buff, SLIP_ESC, SLIP_ESC_ESC)
 		default:
-			buff.WriteByte(b)
-			break
+			buff = append(buff, b)
 		}
 	}
-	buff.WriteByte(SLIP_END)
-	return buff.Bytes()
+	return buff
 }
 
-type SlipDecoder struct {
-	reader io.Reader
-	ch     chan slipPacket
-	closer chan bool
+// Encoder writes SLIP frames to a writer. Write escapes p and appends it to
+// the current frame, opening one first if needed, and EndFrame closes it, so
+// a frame can be streamed in pieces. Every call makes a single write on the
+// underlying writer.
+type Encoder struct {
+	writer  io.Writer
+	buffer  []byte
+	inFrame bool
 }
 
-func (d *SlipDecoder) Read() ([]byte, error) {
-	packet := <-d.ch
-	if packet.Err != nil {
-		return nil, packet.Err
+func NewEncoder(writer io.Writer) *Encoder {
+	return &Encoder{writer: writer, buffer: make([]byte, 0, BUFFER_SIZE)}
+}
+
+// Write returns len(p) if p was written, and 0 otherwise. After an error the
+// current frame is left unterminated, and the next Write opens a new one, so
+// the peer drops the broken frame.
+func (e *Encoder) Write(p []byte) (int, error) {
+	e.buffer = e.buffer[:0]
+	if !e.inFrame {
+		e.buffer = append(e.buffer, SLIP_END)
 	}
-	return packet.Buffer.Bytes(), nil
+	e.buffer = appendEscaped(e.buffer, p)
+	if err := e.flush(); err != nil {
+		return 0, err
+	}
+	e.inFrame = true
+	return len(p), nil
 }
 
-/*
-func (d *SlipDecoder) Close() {
-	close(d.ch)
-}*/
+// EndFrame terminates the current frame, if any.
+func (e *Encoder) EndFrame() error {
+	if !e.inFrame {
+		return nil
+	}
+	e.buffer = append(e.buffer[:0], SLIP_END)
+	return e.flush()
+}
 
-func NewDecoder(reader io.Reader) SlipDecoder {
-	ch := make(chan slipPacket)
-	closer := make(chan bool, 1)
-	go slipChannelDecoder(reader, ch, closer)
-	return SlipDecoder{reader, ch, closer}
+// WriteFrame writes p as a whole frame, terminating the current one first.
+func (e *Encoder) WriteFrame(p []byte) error {
+	e.buffer = e.buffer[:0]
+	if e.inFrame {
+		e.buffer = append(e.buffer, SLIP_END)
+	}
+	e.buffer = appendFrame(e.buffer, p)
+	return e.flush()
 }
 
-func (sd *SlipDecoder) Close() {
-	sd.closer <- true
-	close(sd.closer)
+func (e *Encoder) flush() error {
+	e.inFrame = false
+	_, err := e.writer.Write(e.buffer)
+	return err
 }
 
-func slipChannelDecoder(s io.Reader, c chan<- slipPacket, closer <-chan bool) {
-	buf := make([]byte, BUFFER_SIZE)
-	packet := slipPacket{}
-	packet.Buffer.Grow(BUFFER_SIZE)
-	state := SLIPDEC_STATE_START
-	run := true
-	for run {
-		select {
-		case <-closer:
-			run = false
-			break
-		default:
-			n, err := s.Read(buf)
-			if n == 0 {
-				continue
+// SlipDecoder reads SLIP frames from a reader. It is not safe for concurrent
+// use.
+type SlipDecoder struct {
+	reader       *bufio.Reader
+	buffer       []byte
+	maxFrameSize int
+	state        int
+	err          error
+}
+
+func NewDecoder(reader io.Reader) *SlipDecoder {
+	return NewDecoderSize(reader, DEFAULT_MAX_FRAME_SIZE)
+}
+
+// NewDecoderSize returns a decoder that drops the frames longer than
+// maxFrameSize bytes once decoded.
+func NewDecoderSize(reader io.Reader, maxFrameSize int) *SlipDecoder {
+	return &SlipDecoder{
+		reader:       bufio.NewReaderSize(reader, BUFFER_SIZE),
+		buffer:       make([]byte, 0, BUFFER_SIZE),
+		maxFrameSize: maxFrameSize,
+	}
+}
+
+// ReadFrame blocks until a whole frame is read and returns it in a slice of
+// its own, that the caller may keep or modify. Bytes before the first
+// SLIP_END and empty frames are skipped. A malformed frame is dropped and
+// reported with a *FramingError, after which the decoder skips to the next
+// SLIP_END, so reading can go on. Any error from the reader is returned as
+// is, io.EOF included, and then again on every call, a frame cut by io.EOF
+// being reported first as ErrTruncatedFrame.
+func (d *SlipDecoder) ReadFrame() ([]byte, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	for {
+		b, err := d.reader.ReadByte()
+		if err != nil {
+			d.err = err
+			truncated := d.state == SLIPDEC_STATE_ESC || (d.state == SLIPDEC_STATE_IN_FRAME && len(d.buffer) > 0)
+			if err == io.EOF && truncated {
+				return nil, d.drop(ErrTruncatedFrame)
 			}
-			if err != nil {
-				errInf := slipPacket{Err: err}
-				c <- errInf
+			return nil, err
+		}
+		switch d.state {
+		case SLIPDEC_STATE_START:
+			if b == SLIP_END {
+				d.state = SLIPDEC_STATE_IN_FRAME
 			}
-			for _, b := range buf[:n] {
-				switch state {
-				case SLIPDEC_STATE_START:
-					if b == SLIP_END {
-						state = SLIPDEC_STATE_IN_FRAME
-					}
-					packet.Buffer.Reset()
-					break
-				case SLIPDEC_STATE_IN_FRAME:
-					switch b {
-					case SLIP_END:
-						if packet.Buffer.Len() != 0 {
-							c <- packet
-						}
-						packet.Buffer.Reset()
-						state = SLIPDEC_STATE_START
-						break
-					case SLIP_ESC:
-						state = SLIPDEC_STATE_ESC
-						break
-					default:
-						packet.Buffer.WriteByte(b)
-						break
-					}
-					break
-				case SLIPDEC_STATE_ESC:
-					switch b {
-					case SLIP_ESC_END:
-						packet.Buffer.WriteByte(SLIP_END)
-						state = SLIPDEC_STATE_IN_FRAME
-						break
-					case SLIP_ESC_ESC:
-						packet.Buffer.WriteByte(SLIP_ESC)
-						state = SLIPDEC_STATE_IN_FRAME
-						break
-					default:
-						state = SLIPDEC_STATE_START
-						break
-					}
+		case SLIPDEC_STATE_IN_FRAME:
+			switch b {
+			case SLIP_END:
+				// back-to-back ENDs delimit an empty frame, stay in frame
+				if len(d.buffer) == 0 {
 					break
 				}
+				// the frame is copied as the buffer is reused for the next one
+				frame := append([]byte(nil), d.buffer...)
+				d.buffer = d.buffer[:0]
+				d.state = SLIPDEC_STATE_START
+				return frame, nil
+			case SLIP_ESC:
+				d.state = SLIPDEC_STATE_ESC
+			default:
+				if err := d.writeByte(b); err != nil {
+					return nil, err
+				}
 			}
+		case SLIPDEC_STATE_ESC:
+			switch b {
+			case SLIP_ESC_END:
+				b = SLIP_END
+			case SLIP_ESC_ESC:
+				b = SLIP_ESC
+			default:
+				return nil, d.drop(ErrInvalidEscape)
+			}
+			if err := d.writeByte(b); err != nil {
+				return nil, err
+			}
+			d.state = SLIPDEC_STATE_IN_FRAME
 		}
 	}
-	close(c)
+}
+
+// Deprecated: use ReadFrame.
+func (d *SlipDecoder) Read() ([]byte, error) {
+	return d.ReadFrame()
+}
+
+func (d *SlipDecoder) writeByte(b byte) error {
+	if len(d.buffer) >= d.maxFrameSize {
+		return d.drop(ErrFrameTooLarge)
+	}
+	d.buffer = append(d.buffer, b)
+	return nil
+}
+
+func (d *SlipDecoder) drop(err error) error {
+	framingErr := &FramingError{Err: err, Length: len(d.buffer)}
+	d.buffer = d.buffer[:0]
+	d.state = SLIPDEC_STATE_START
+	return framingErr
 }
@@ -1,5 +1,7 @@
 package wimod
 
+import "fmt"
+
 const (
 	DEVMGMT_ID byte = 0x01
 	LORAWAN_ID byte = 0x10
@@ -115,6 +117,27 @@ const (
 	LORAWAN_STATUS_CHANNEL_NOT_AVAILABLE byte = 0x0B
 )
 
+const (
+	LORAWAN_RSTACK_CONFIG_WRONG_DATA_RATE      = 0x01
+	LORAWAN_RSTACK_CONFIG_WRONG_TX_POWER_LEVEL = 0x02
+	LORAWAN_RSTACK_CONFIG_WRONG_BAND_INDEX     = 0x20
+)
+
+const (
+	LORAWAN_LINKADRREQ_OPTION_V1_0_2       byte = 0x00
+	LORAWAN_LINKADRREQ_OPTION_SEMTECH      byte = 0x01
+	LORAWAN_LINKADRREQ_OPTION_KPN_ACTILITY byte = 0x02
+)
+
+const (
+	LORAWAN_MAC_CMD_SERVICE_UNRELIABLE byte = 0x00
+	LORAWAN_MAC_CMD_SERVICE_RELIABLE   byte = 0x01
+)
+
+const (
+	LORAWAN_MSG_RECV_MAC_CMD_IND_STATUS_ATTACHMENT byte = 0x01
+)
+
 const (
 	LORAWAN_NETWORK_STATUS_INACTIVE     = 0x00
 	LORAWAN_NETWORK_STATUS_ACTIVE_ABP   = 0x01
@@ -134,6 +157,27 @@ const (
 	LORAWAN_MSG_SEND_UDATA_TX_IND_STATUS_OK            = 0x00
 	LORAWAN_MSG_SEND_UDATA_TX_IND_STATUS_OK_ATTACHMENT = 0x01
 	LORAWAN_MSG_SEND_UDATA_TX_IND_STATUS_ERROR         = 0x02
+
+	LORAWAN_MSG_SEND_CDATA_TX_IND_STATUS_OK                  = 0x00
+	LORAWAN_MSG_SEND_CDATA_TX_IND_STATUS_OK_ATTACHMENT       = 0x01
+	LORAWAN_MSG_SEND_CDATA_TX_IND_STATUS_MAX_RETRANSMISSIONS = 0x02
+	LORAWAN_MSG_SEND_CDATA_TX_IND_STATUS_MAX_PAYLOAD_SIZE    = 0x04
+
+	LORAWAN_MSG_RECV_DATA_IND_STATUS_ATTACHMENT    = 0x01
+	LORAWAN_MSG_RECV_DATA_IND_STATUS_ACK           = 0x02
+	LORAWAN_MSG_RECV_DATA_IND_STATUS_FRAME_PENDING = 0x04
+
+	LORAWAN_MSG_RECV_NO_DATA_IND_STATUS_ERROR_CODE = 0x02
+)
+
+const (
+	LORAWAN_RECV_NO_DATA_ERROR_WRONG_MTYPE          = 0x01
+	LORAWAN_RECV_NO_DATA_ERROR_WRONG_DEVICE_ADDRESS = 0x02
+	LORAWAN_RECV_NO_DATA_ERROR_WRONG_MIC            = 0x04
+	LORAWAN_RECV_NO_DATA_ERROR_UNEXPECTED_FCNT      = 0x08
+	LORAWAN_RECV_NO_DATA_ERROR_WRONG_MAC_COMMANDS   = 0x10
+	LORAWAN_RECV_NO_DATA_ERROR_WRONG_DOWNLINK       = 0x20
+	LORAWAN_RECV_NO_DATA_ERROR_EXPECTED_ACK_MISSING = 0x40
 )
 
 var alarmConstructors = map[uint16]func() WiModMessageInd{
@@ -141,9 +185,97 @@ var alarmConstructors = map[uint16]func() WiModMessageInd{
 	LORAWAN_MSG_JOIN_NETWORK_TX_IND: func() WiModMessageInd { return NewJoinNetworkTxInd() },
 	LORAWAN_MSG_JOIN_NETWORK_IND:    func() WiModMessageInd { return NewJoinNetworkInd() },
 	LORAWAN_MSG_SEND_UDATA_TX_IND:   func() WiModMessageInd { return NewSendUDataTxInd() },
+	LORAWAN_MSG_RECV_UDATA_IND:      func() WiModMessageInd { return NewRecvUDataInd() },
+	LORAWAN_MSG_SEND_CDATA_TX_IND:   func() WiModMessageInd { return NewSendCDataTxInd() },
+	LORAWAN_MSG_RECV_CDATA_IND:      func() WiModMessageInd { return NewRecvCDataInd() },
+	LORAWAN_MSG_RECV_ACK_IND:        func() WiModMessageInd { return NewRecvAckInd() },
+	LORAWAN_MSG_RECV_NO_DATA_IND:    func() WiModMessageInd { return NewRecvNoDataInd() },
+	LORAWAN_MSG_RECV_MAC_CMD_IND:    func() WiModMessageInd { return NewRecvMACCmdInd() },
 }
 
 func IsAlarm(code uint16) bool {
 	_, ok := alarmConstructors[code]
 	return ok
 }
+
+var messageNames = map[uint16]string{
+	DEVMGMT_MSG_PING_REQ:                  "DEVMGMT_MSG_PING_REQ",
+	DEVMGMT_MSG_PING_RSP:                  "DEVMGMT_MSG_PING_RSP",
+	DEVMGMT_MSG_GET_DEVICE_INFO_REQ:       "DEVMGMT_MSG_GET_DEVICE_INFO_REQ",
+	DEVMGMT_MSG_GET_DEVICE_INFO_RSP:       "DEVMGMT_MSG_GET_DEVICE_INFO_RSP",
+	DEVMGMT_MSG_GET_FW_INFO_REQ:           "DEVMGMT_MSG_GET_FW_INFO_REQ",
+	DEVMGMT_MSG_GET_FW_INFO_RSP:           "DEVMGMT_MSG_GET_FW_INFO_RSP",
+	DEVMGMT_MSG_RESET_REQ:                 "DEVMGMT_MSG_RESET_REQ",
+	DEVMGMT_MSG_RESET_RSP:                 "DEVMGMT_MSG_RESET_RSP",
+	DEVMGMT_MSG_SET_OPMODE_REQ:            "DEVMGMT_MSG_SET_OPMODE_REQ",
+	DEVMGMT_MSG_SET_OPMODE_RSP:            "DEVMGMT_MSG_SET_OPMODE_RSP",
+	DEVMGMT_MSG_GET_OPMODE_REQ:            "DEVMGMT_MSG_GET_OPMODE_REQ",
+	DEVMGMT_MSG_GET_OPMODE_RSP:            "DEVMGMT_MSG_GET_OPMODE_RSP",
+	DEVMGMT_MSG_SET_RTC_REQ:               "DEVMGMT_MSG_SET_RTC_REQ",
+	DEVMGMT_MSG_SET_RTC_RSP:               "DEVMGMT_MSG_SET_RTC_RSP",
+	DEVMGMT_MSG_GET_RTC_REQ:               "DEVMGMT_MSG_GET_RTC_REQ",
+	DEVMGMT_MSG_GET_RTC_RSP:               "DEVMGMT_MSG_GET_RTC_RSP",
+	DEVMGMT_MSG_GET_DEVICE_STATUS_REQ:     "DEVMGMT_MSG_GET_DEVICE_STATUS_REQ",
+	DEVMGMT_MSG_GET_DEVICE_STATUS_RSP:     "DEVMGMT_MSG_GET_DEVICE_STATUS_RSP",
+	DEVMGMT_MSG_SET_RTC_ALARM_REQ:         "DEVMGMT_MSG_SET_RTC_ALARM_REQ",
+	DEVMGMT_MSG_SET_RTC_ALARM_RSP:         "DEVMGMT_MSG_SET_RTC_ALARM_RSP",
+	DEVMGMT_MSG_CLEAR_RTC_ALARM_REQ:       "DEVMGMT_MSG_CLEAR_RTC_ALARM_REQ",
+	DEVMGMT_MSG_CLEAR_RTC_ALARM_RSP:       "DEVMGMT_MSG_CLEAR_RTC_ALARM_RSP",
+	DEVMGMT_MSG_GET_RTC_ALARM_REQ:         "DEVMGMT_MSG_GET_RTC_ALARM_REQ",
+	DEVMGMT_MSG_GET_RTC_ALARM_RSP:         "DEVMGMT_MSG_GET_RTC_ALARM_RSP",
+	DEVMGMT_MSG_RTC_ALARM_IND:             "DEVMGMT_MSG_RTC_ALARM_IND",
+	LORAWAN_MSG_ACTIVATE_DEVICE_REQ:       "LORAWAN_MSG_ACTIVATE_DEVICE_REQ",
+	LORAWAN_MSG_ACTIVATE_DEVICE_RSP:       "LORAWAN_MSG_ACTIVATE_DEVICE_RSP",
+	LORAWAN_MSG_SET_JOIN_PARAM_REQ:        "LORAWAN_MSG_SET_JOIN_PARAM_REQ",
+	LORAWAN_MSG_SET_JOIN_PARAM_RSP:        "LORAWAN_MSG_SET_JOIN_PARAM_RSP",
+	LORAWAN_MSG_JOIN_NETWORK_REQ:          "LORAWAN_MSG_JOIN_NETWORK_REQ",
+	LORAWAN_MSG_JOIN_NETWORK_RSP:          "LORAWAN_MSG_JOIN_NETWORK_RSP",
+	LORAWAN_MSG_JOIN_NETWORK_TX_IND:       "LORAWAN_MSG_JOIN_NETWORK_TX_IND",
+	LORAWAN_MSG_JOIN_NETWORK_IND:          "LORAWAN_MSG_JOIN_NETWORK_IND",
+	LORAWAN_MSG_SEND_UDATA_REQ:            "LORAWAN_MSG_SEND_UDATA_REQ",
+	LORAWAN_MSG_SEND_UDATA_RSP:            "LORAWAN_MSG_SEND_UDATA_RSP",
+	LORAWAN_MSG_SEND_UDATA_TX_IND:         "LORAWAN_MSG_SEND_UDATA_TX_IND",
+	LORAWAN_MSG_RECV_UDATA_IND:            "LORAWAN_MSG_RECV_UDATA_IND",
+	LORAWAN_MSG_SEND_CDATA_REQ:            "LORAWAN_MSG_SEND_CDATA_REQ",
+	LORAWAN_MSG_SEND_CDATA_RSP:            "LORAWAN_MSG_SEND_CDATA_RSP",
+	LORAWAN_MSG_SEND_CDATA_TX_IND:         "LORAWAN_MSG_SEND_CDATA_TX_IND",
+	LORAWAN_MSG_RECV_CDATA_IND:            "LORAWAN_MSG_RECV_CDATA_IND",
+	LORAWAN_MSG_RECV_ACK_IND:              "LORAWAN_MSG_RECV_ACK_IND",
+	LORAWAN_MSG_RECV_NO_DATA_IND:          "LORAWAN_MSG_RECV_NO_DATA_IND",
+	LORAWAN_MSG_SET_RSTACK_CONFIG_REQ:     "LORAWAN_MSG_SET_RSTACK_CONFIG_REQ",
+	LORAWAN_MSG_SET_RSTACK_CONFIG_RSP:     "LORAWAN_MSG_SET_RSTACK_CONFIG_RSP",
+	LORAWAN_MSG_GET_RSTACK_CONFIG_REQ:     "LORAWAN_MSG_GET_RSTACK_CONFIG_REQ",
+	LORAWAN_MSG_GET_RSTACK_CONFIG_RSP:     "LORAWAN_MSG_GET_RSTACK_CONFIG_RSP",
+	LORAWAN_MSG_REACTIVATE_DEVICE_REQ:     "LORAWAN_MSG_REACTIVATE_DEVICE_REQ",
+	LORAWAN_MSG_REACTIVATE_DEVICE_RSP:     "LORAWAN_MSG_REACTIVATE_DEVICE_RSP",
+	LORAWAN_MSG_DEACTIVATE_DEVICE_REQ:     "LORAWAN_MSG_DEACTIVATE_DEVICE_REQ",
+	LORAWAN_MSG_DEACTIVATE_DEVICE_RSP:     "LORAWAN_MSG_DEACTIVATE_DEVICE_RSP",
+	LORAWAN_MSG_FACTORY_RESET_REQ:         "LORAWAN_MSG_FACTORY_RESET_REQ",
+	LORAWAN_MSG_FACTORY_RESET_RSP:         "LORAWAN_MSG_FACTORY_RESET_RSP",
+	LORAWAN_MSG_SET_DEVICE_EUI_REQ:        "LORAWAN_MSG_SET_DEVICE_EUI_REQ",
+	LORAWAN_MSG_SET_DEVICE_EUI_RSP:        "LORAWAN_MSG_SET_DEVICE_EUI_RSP",
+	LORAWAN_MSG_GET_DEVICE_EUI_REQ:        "LORAWAN_MSG_GET_DEVICE_EUI_REQ",
+	LORAWAN_MSG_GET_DEVICE_EUI_RSP:        "LORAWAN_MSG_GET_DEVICE_EUI_RSP",
+	LORAWAN_MSG_GET_NWK_STATUS_REQ:        "LORAWAN_MSG_GET_NWK_STATUS_REQ",
+	LORAWAN_MSG_GET_NWK_STATUS_RSP:        "LORAWAN_MSG_GET_NWK_STATUS_RSP",
+	LORAWAN_MSG_SEND_MAC_CMD_REQ:          "LORAWAN_MSG_SEND_MAC_CMD_REQ",
+	LORAWAN_MSG_SEND_MAC_CMD_RSP:          "LORAWAN_MSG_SEND_MAC_CMD_RSP",
+	LORAWAN_MSG_RECV_MAC_CMD_IND:          "LORAWAN_MSG_RECV_MAC_CMD_IND",
+	LORAWAN_MSG_SET_CUSTOM_CFG_REQ:        "LORAWAN_MSG_SET_CUSTOM_CFG_REQ",
+	LORAWAN_MSG_SET_CUSTOM_CFG_RSP:        "LORAWAN_MSG_SET_CUSTOM_CFG_RSP",
+	LORAWAN_MSG_GET_CUSTOM_CFG_REQ:        "LORAWAN_MSG_GET_CUSTOM_CFG_REQ",
+	LORAWAN_MSG_GET_CUSTOM_CFG_RSP:        "LORAWAN_MSG_GET_CUSTOM_CFG_RSP",
+	LORAWAN_MSG_GET_SUPPORTED_BANDS_REQ:   "LORAWAN_MSG_GET_SUPPORTED_BANDS_REQ",
+	LORAWAN_MSG_GET_SUPPORTED_BANDS_RSP:   "LORAWAN_MSG_GET_SUPPORTED_BANDS_RSP",
+	LORAWAN_MSG_SET_LINKADRREQ_CONFIG_REQ: "LORAWAN_MSG_SET_LINKADRREQ_CONFIG_REQ",
+	LORAWAN_MSG_SET_LINKADRREQ_CONFIG_RSP: "LORAWAN_MSG_SET_LINKADRREQ_CONFIG_RSP",
+	LORAWAN_MSG_GET_LINKADRREQ_CONFIG_REQ: "LORAWAN_MSG_GET_LINKADRREQ_CONFIG_REQ",
+	LORAWAN_MSG_GET_LINKADRREQ_CONFIG_RSP: "LORAWAN_MSG_GET_LINKADRREQ_CONFIG_RSP",
+}
+
+func MessageName(code uint16) string {
+	if name, ok := messageNames[code]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%04X", code)
+}
@@ -51,8 +51,11 @@ func (p *PingResp) String() string {
 }
 
 func (p *PingResp) Decode(payload []byte) error {
+	if err := checkPayloadSize(p.Code(), payload, 1); err != nil {
+		return err
+	}
 	p.Status = payload[0]
-	return devMgmtStatusCheck(p.Status)
+	return devMgmtStatusCheck(p.Code(), p.Status)
 }
 
 // DEVMGMT_MSG_GET_DEVICE_INFO_REQ
@@ -103,11 +106,17 @@ func (p *GetDeviceInfoResp) String() string {
 }
 
 func (p *GetDeviceInfoResp) Decode(payload []byte) error {
+	if err := checkPayloadSize(p.Code(), payload, 1); err != nil {
+		return err
+	}
 	p.Status = payload[0]
-	err := devMgmtStatusCheck(p.Status)
+	err := devMgmtStatusCheck(p.Code(), p.Status)
 	if err != nil {
 		return err
 	}
+	if err := checkPayloadSize(p.Code(), payload, 10); err != nil {
+		return err
+	}
 	bytes := payload[1:]
 	p.ModuleType = bytes[0]
 	p.DeviceAddress = binary.LittleEndian.Uint32(bytes[1:5])
@@ -165,11 +174,17 @@ func (p *GetFWInfoResp) String() string {
 }
 
 func (p *GetFWInfoResp) Decode(payload []byte) error {
+	if err := checkPayloadSize(p.Code(), payload, 1); err != nil {
+		return err
+	}
 	p.Status = payload[0]
-	err := devMgmtStatusCheck(p.Status)
+	err := devMgmtStatusCheck(p.Code(), p.Status)
 	if err != nil {
 		return err
 	}
+	if err := checkPayloadSize(p.Code(), payload, 15); err != nil {
+		return err
+	}
 	bytes := payload[1:]
 	p.MinorVersion = bytes[0]
 	p.MajorVersion = bytes[1]
@@ -224,8 +239,11 @@ func (p *ResetResp) String() string {
 }
 
 func (p *ResetResp) Decode(payload []byte) error {
+	if err := checkPayloadSize(p.Code(), payload, 1); err != nil {
+		return err
+	}
 	p.Status = payload[0]
-	return devMgmtStatusCheck(p.Status)
+	return devMgmtStatusCheck(p.Code(), p.Status)
 }
 
 // DEVMGMT_MSG_SET_OPMODE_REQ
@@ -275,8 +293,11 @@ func (p *SetOPModeResp) String() string {
 }
 
 func (p *SetOPModeResp) Decode(payload []byte) error {
+	if err := checkPayloadSize(p.Code(), payload, 1); err != nil {
+		return err
+	}
 	p.Status = payload[0]
-	return devMgmtStatusCheck(p.Status)
+	return devMgmtStatusCheck(p.Code(), p.Status)
 }
 
 // DEVMGMT_MSG_GET_OPMODE_REQ
@@ -325,11 +346,17 @@ func (p *GetOPModeResp) String() string {
 }
 
 func (p *GetOPModeResp) Decode(payload []byte) error {
+	if err := checkPayloadSize(p.Code(), payload, 1); err != nil {
+		return err
+	}
 	p.Status = payload[0]
-	err := devMgmtStatusCheck(p.Status)
+	err := devMgmtStatusCheck(p.Code(), p.Status)
 	if err != nil {
 		return err
 	}
+	if err := checkPayloadSize(p.Code(), payload, 2); err != nil {
+		return err
+	}
 	p.Mode = payload[1]
 	return nil
 }
@@ -383,8 +410,11 @@ func (p *SetRTCResp) String() string {
 }
 
 func (p *SetRTCResp) Decode(payload []byte) error {
+	if err := checkPayloadSize(p.Code(), payload, 1); err != nil {
+		return err
+	}
 	p.Status = payload[0]
-	return devMgmtStatusCheck(p.Status)
+	return devMgmtStatusCheck(p.Code(), p.Status)
 }
 
 // DEVMGMT_MSG_GET_RTC_REQ
@@ -433,12 +463,18 @@ func (p *GetRTCResp) String() string {
 }
 
 func (p *GetRTCResp) Decode(payload []byte) error {
+	if err := checkPayloadSize(p.Code(), payload, 1); err != nil {
+		return err
+	}
 	p.Status = payload[0]
-	err := devMgmtStatusCheck(p.Status)
+	err := devMgmtStatusCheck(p.Code(), p.Status)
 	if err != nil {
 		return err
 	}
-	p.Time = DecodeRTCTime(binary.LittleEndian.Uint32(payload[1:]))
+	if err := checkPayloadSize(p.Code(), payload, 5); err != nil {
+		return err
+	}
+	p.Time = DecodeRTCTime(binary.LittleEndian.Uint32(payload[1:5]))
 	return nil
 }
 
@@ -504,11 +540,17 @@ func (p *GetDeviceStatusResp) String() string {
 }
 
 func (p *GetDeviceStatusResp) Decode(payload []byte) error {
+	if err := checkPayloadSize(p.Code(), payload, 1); err != nil {
+		return err
+	}
 	p.Status = payload[0]
-	err := devMgmtStatusCheck(p.Status)
+	err := devMgmtStatusCheck(p.Code(), p.Status)
 	if err != nil {
 		return err
 	}
+	if err := checkPayloadSize(p.Code(), payload, 60); err != nil {
+		return err
+	}
 	bytes := payload[1:]
 	p.SystemTickResolution = bytes[0]
 	p.SystemTicks = binary.LittleEndian.Uint32(bytes[1:5])
@@ -593,8 +635,11 @@ func (p *SetRTCAlarmResp) String() string {
 }
 
 func (p *SetRTCAlarmResp) Decode(payload []byte) error {
+	if err := checkPayloadSize(p.Code(), payload, 1); err != nil {
+		return err
+	}
 	p.Status = payload[0]
-	return devMgmtStatusCheck(p.Status)
+	return devMgmtStatusCheck(p.Code(), p.Status)
 }
 
 // DEVMGMT_MSG_CLEAR_RTC_ALARM_REQ
@@ -642,8 +687,11 @@ func (p *ClearRTCAlarmResp) String() string {
 }
 
 func (p *ClearRTCAlarmResp) Decode(payload []byte) error {
+	if err := checkPayloadSize(p.Code(), payload, 1); err != nil {
+		return err
+	}
 	p.Status = payload[0]
-	return devMgmtStatusCheck(p.Status)
+	return devMgmtStatusCheck(p.Code(), p.Status)
 }
 
 // DEVMGMT_MSG_GET_RTC_ALARM_REQ
@@ -696,11 +744,17 @@ func (p *GetRTCAlarmResp) String() string {
 }
 
 func (p *GetRTCAlarmResp) Decode(payload []byte) error {
+	if err := checkPayloadSize(p.Code(), payload, 1); err != nil {
+		return err
+	}
 	p.Status = payload[0]
-	err := devMgmtStatusCheck(p.Status)
+	err := devMgmtStatusCheck(p.Code(), p.Status)
 	if err != nil {
 		return err
 	}
+	if err := checkPayloadSize(p.Code(), payload, 6); err != nil {
+		return err
+	}
 	bytes := payload[1:]
 	p.AlarmStatus = bytes[0]
 	p.AlarmType = bytes[1]
@@ -731,6 +785,9 @@ func (p *RTCAlarmInd) String() string {
 }
 
 func (p *RTCAlarmInd) Decode(payload []byte) error {
+	if err := checkPayloadSize(p.Code(), payload, 1); err != nil {
+		return err
+	}
 	p.Status = payload[0]
-	return devMgmtStatusCheck(p.Status)
+	return devMgmtStatusCheck(p.Code(), p.Status)
 }
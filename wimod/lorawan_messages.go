@@ -3,6 +3,9 @@ package wimod
 import (
 	"encoding/binary"
 	"fmt"
+	"strings"
+
+	"github.com/enolgor/wimod-lorawan-endnode-controller/mac"
 )
 
 // LORAWAN_MSG_ACTIVATE_DEVICE_REQ
@@ -60,8 +63,11 @@ func (p *ActivateDeviceResp) String() string {
 }
 
 func (p *ActivateDeviceResp) Decode(payload []byte) error {
+	if err := checkPayloadSize(p.Code(), payload, 1); err != nil {
+		return err
+	}
 	p.Status = payload[0]
-	return lorawanStatusCheck(p.Status)
+	return lorawanStatusCheck(p.Code(), p.Status)
 }
 
 // LORAWAN_MSG_SET_JOIN_PARAM_REQ
@@ -115,8 +121,11 @@ func (p *SetJoinParamResp) String() string {
 }
 
 func (p *SetJoinParamResp) Decode(payload []byte) error {
+	if err := checkPayloadSize(p.Code(), payload, 1); err != nil {
+		return err
+	}
 	p.Status = payload[0]
-	return lorawanStatusCheck(p.Status)
+	return lorawanStatusCheck(p.Code(), p.Status)
 }
 
 // LORAWAN_MSG_JOIN_NETWORK_REQ
@@ -164,19 +173,18 @@ func (p *JoinNetworkResp) String() string {
 }
 
 func (p *JoinNetworkResp) Decode(payload []byte) error {
+	if err := checkPayloadSize(p.Code(), payload, 1); err != nil {
+		return err
+	}
 	p.Status = payload[0]
-	return lorawanStatusCheck(p.Status)
+	return lorawanStatusCheck(p.Code(), p.Status)
 }
 
 // LORAWAN_MSG_JOIN_NETWORK_TX_IND
 
 type JoinNetworkTxInd struct {
 	wimodMessageStatusImpl
-	ChannelIdx       byte
-	DataRateIdx      byte
-	NumTxPackets     byte
-	TRXPowerLevel    byte
-	RFMessageAirtime uint32
+	TxMetadata
 }
 
 func NewJoinNetworkTxInd() *JoinNetworkTxInd {
@@ -194,17 +202,14 @@ func (p *JoinNetworkTxInd) String() string {
 }
 
 func (p *JoinNetworkTxInd) Decode(bytes []byte) error {
+	if err := checkPayloadSize(p.Code(), bytes, 1); err != nil {
+		return err
+	}
 	p.Status = bytes[0]
 	if p.Status != LORAWAN_MSG_JOIN_NETWORK_TX_IND_STATUS_OK && p.Status != LORAWAN_MSG_JOIN_NETWORK_TX_IND_STATUS_OK_ATTACHMENT {
 		p.Status = LORAWAN_MSG_JOIN_NETWORK_TX_IND_STATUS_ERROR
 	}
-	if p.Status == LORAWAN_MSG_JOIN_NETWORK_TX_IND_STATUS_OK_ATTACHMENT {
-		p.ChannelIdx = bytes[1]
-		p.DataRateIdx = bytes[2]
-		p.NumTxPackets = bytes[3]
-		p.TRXPowerLevel = bytes[4]
-		p.RFMessageAirtime = binary.LittleEndian.Uint32(bytes[5:9])
-	}
+	p.decodeTxMetadata(bytes, p.Status == LORAWAN_MSG_JOIN_NETWORK_TX_IND_STATUS_OK_ATTACHMENT)
 	return nil
 }
 
@@ -212,12 +217,8 @@ func (p *JoinNetworkTxInd) Decode(bytes []byte) error {
 
 type JoinNetworkInd struct {
 	wimodMessageStatusImpl
-	Address     uint32
-	ChannelIdx  byte
-	DataRateIdx byte
-	RSSI        byte
-	SNR         byte
-	RxSlot      byte
+	Address uint32
+	RxMetadata
 }
 
 func NewJoinNetworkInd() *JoinNetworkInd {
@@ -235,17 +236,16 @@ func (p *JoinNetworkInd) String() string {
 }
 
 func (p *JoinNetworkInd) Decode(bytes []byte) error {
+	if err := checkPayloadSize(p.Code(), bytes, 1); err != nil {
+		return err
+	}
 	p.Status = bytes[0]
 	if p.Status != LORAWAN_MSG_JOIN_NETWORK_IND_STATUS_OK && p.Status != LORAWAN_MSG_JOIN_NETWORK_IND_STATUS_OK_ATTACHMENT {
 		p.Status = LORAWAN_MSG_JOIN_NETWORK_IND_STATUS_ERROR
 	}
-	if p.Status == LORAWAN_MSG_JOIN_NETWORK_IND_STATUS_OK_ATTACHMENT {
+	end := p.decodeRxMetadata(bytes, p.Status == LORAWAN_MSG_JOIN_NETWORK_IND_STATUS_OK_ATTACHMENT)
+	if p.Status != LORAWAN_MSG_JOIN_NETWORK_IND_STATUS_ERROR && end >= 5 {
 		p.Address = binary.LittleEndian.Uint32(bytes[1:5])
-		p.ChannelIdx = bytes[5]
-		p.DataRateIdx = bytes[6]
-		p.RSSI = bytes[7]
-		p.SNR = bytes[8]
-		p.RxSlot = bytes[9]
 	}
 	return nil
 }
@@ -302,27 +302,31 @@ func (p *SendUDataResp) String() string {
 }
 
 func (p *SendUDataResp) Decode(payload []byte) error {
+	if err := checkPayloadSize(p.Code(), payload, 1); err != nil {
+		return err
+	}
 	p.Status = payload[0]
 	switch p.Status {
 	case LORAWAN_STATUS_OK:
 		return nil
 	case LORAWAN_STATUS_CHANNEL_BLOCKED:
+		if err := checkPayloadSize(p.Code(), payload, 5); err != nil {
+			return err
+		}
 		p.RemainingTime = binary.LittleEndian.Uint32(payload[1:5])
-		return fmt.Errorf("LORAWAN_STATUS_CHANNEL_BLOCKED: Remaining Time: %d", p.RemainingTime)
+		return &StatusError{Endpoint: LORAWAN_ID, Code: p.Status, MessageCode: p.Code(), RemainingTime: p.RemainingTime}
 	default:
-		return lorawanStatusCheck(payload[0])
+		return lorawanStatusCheck(p.Code(), p.Status)
 	}
 }
 
 // LORAWAN_MSG_SEND_UDATA_TX_IND
 
+// SendUDataTxInd reports whether an unconfirmed uplink was sent. Decode fails
+// with a *StatusError if it was not, the indication still holding its Status.
 type SendUDataTxInd struct {
 	wimodMessageStatusImpl
-	ChannelIdx       byte
-	DataRateIdx      byte
-	NumTxPackets     byte
-	TRXPowerLevel    byte
-	RFMessageAirtime uint32
+	TxMetadata
 }
 
 func NewSendUDataTxInd() *SendUDataTxInd {
@@ -340,30 +344,401 @@ func (p *SendUDataTxInd) String() string {
 }
 
 func (p *SendUDataTxInd) Decode(bytes []byte) error {
+	if err := checkPayloadSize(p.Code(), bytes, 1); err != nil {
+		return err
+	}
 	p.Status = bytes[0]
 	if p.Status != LORAWAN_MSG_SEND_UDATA_TX_IND_STATUS_OK && p.Status != LORAWAN_MSG_SEND_UDATA_TX_IND_STATUS_OK_ATTACHMENT {
 		p.Status = LORAWAN_MSG_SEND_UDATA_TX_IND_STATUS_ERROR
-		return fmt.Errorf("LORAWAN_MSG_SEND_UDATA_TX_IND_STATUS_ERROR")
-	}
-	if p.Status == LORAWAN_MSG_SEND_UDATA_TX_IND_STATUS_OK_ATTACHMENT {
-		p.ChannelIdx = bytes[1]
-		p.DataRateIdx = bytes[2]
-		p.NumTxPackets = bytes[3]
-		p.TRXPowerLevel = bytes[4]
-		p.RFMessageAirtime = binary.LittleEndian.Uint32(bytes[5:9])
+		return &StatusError{Endpoint: LORAWAN_ID, Code: p.Status, MessageCode: p.Code()}
 	}
+	p.decodeTxMetadata(bytes, p.Status == LORAWAN_MSG_SEND_UDATA_TX_IND_STATUS_OK_ATTACHMENT)
 	return nil
 }
 
 // LORAWAN_MSG_RECV_UDATA_IND
+
+type RecvUDataInd struct {
+	wimodMessageStatusImpl
+	Ack          bool
+	FramePending bool
+	Port         byte
+	Payload      []byte
+	RxMetadata
+}
+
+func NewRecvUDataInd() *RecvUDataInd {
+	ind := &RecvUDataInd{}
+	ind.Init()
+	return ind
+}
+
+func (p *RecvUDataInd) Init() {
+	p.code = LORAWAN_MSG_RECV_UDATA_IND
+}
+
+func (p *RecvUDataInd) String() string {
+	return fmt.Sprintf("RecvUDataInd[Status: 0x%02X, Ack: %t, FramePending: %t, Port: %d, Payload: 0x%X, ChannelIdx: %d, DataRateIdx: %d, RSSI: %d, SNR: %d, RxSlot: %d]", p.Status, p.Ack, p.FramePending, p.Port, p.Payload, p.ChannelIdx, p.DataRateIdx, p.RSSI, p.SNR, p.RxSlot)
+}
+
+func (p *RecvUDataInd) Decode(bytes []byte) error {
+	if err := checkPayloadSize(p.Code(), bytes, 1); err != nil {
+		return err
+	}
+	p.Status = bytes[0]
+	p.Ack = p.Status&LORAWAN_MSG_RECV_DATA_IND_STATUS_ACK != 0
+	p.FramePending = p.Status&LORAWAN_MSG_RECV_DATA_IND_STATUS_FRAME_PENDING != 0
+	end := p.decodeRxMetadata(bytes, p.Status&LORAWAN_MSG_RECV_DATA_IND_STATUS_ATTACHMENT != 0)
+	if end > 1 {
+		p.Port = bytes[1]
+		p.Payload = append([]byte{}, bytes[2:end]...)
+	}
+	return nil
+}
+
 // LORAWAN_MSG_SEND_CDATA_REQ
+
+type SendCDataReq struct {
+	wimodMessageImpl
+	Port    byte
+	Payload []byte
+}
+
+func NewSendCDataReq(port byte, payload []byte) *SendCDataReq {
+	req := &SendCDataReq{}
+	req.Init()
+	req.Port = port
+	req.Payload = payload
+	return req
+}
+
+func (p *SendCDataReq) Init() {
+	p.code = LORAWAN_MSG_SEND_CDATA_REQ
+}
+
+func (p *SendCDataReq) String() string {
+	return fmt.Sprintf("SendCDataReq[Port: %d, Payload: 0x%X]", p.Port, p.Payload)
+}
+
+func (p *SendCDataReq) Encode() ([]byte, error) {
+	buff := []byte{p.Port}
+	buff = append(buff, p.Payload...)
+	return buff, nil
+}
+
 // LORAWAN_MSG_SEND_CDATA_RSP
+
+type SendCDataResp struct {
+	wimodMessageStatusImpl
+	RemainingTime uint32
+}
+
+func NewSendCDataResp() *SendCDataResp {
+	resp := &SendCDataResp{}
+	resp.Init()
+	return resp
+}
+
+func (p *SendCDataResp) Init() {
+	p.code = LORAWAN_MSG_SEND_CDATA_RSP
+}
+
+func (p *SendCDataResp) String() string {
+	return fmt.Sprintf("SendCDataResp[RemainingTime: %d]", p.RemainingTime)
+}
+
+func (p *SendCDataResp) Decode(payload []byte) error {
+	if err := checkPayloadSize(p.Code(), payload, 1); err != nil {
+		return err
+	}
+	p.Status = payload[0]
+	switch p.Status {
+	case LORAWAN_STATUS_OK:
+		return nil
+	case LORAWAN_STATUS_CHANNEL_BLOCKED:
+		if err := checkPayloadSize(p.Code(), payload, 5); err != nil {
+			return err
+		}
+		p.RemainingTime = binary.LittleEndian.Uint32(payload[1:5])
+		return &StatusError{Endpoint: LORAWAN_ID, Code: p.Status, MessageCode: p.Code(), RemainingTime: p.RemainingTime}
+	default:
+		return lorawanStatusCheck(p.Code(), p.Status)
+	}
+}
+
 // LORAWAN_MSG_SEND_CDATA_TX_IND
+
+// SendCDataTxInd reports whether a confirmed uplink was sent. Decode fails
+// with a *StatusError if it was not, the indication still holding its Status.
+type SendCDataTxInd struct {
+	wimodMessageStatusImpl
+	TxMetadata
+}
+
+func NewSendCDataTxInd() *SendCDataTxInd {
+	ind := &SendCDataTxInd{}
+	ind.Init()
+	return ind
+}
+
+func (p *SendCDataTxInd) Init() {
+	p.code = LORAWAN_MSG_SEND_CDATA_TX_IND
+}
+
+func (p *SendCDataTxInd) String() string {
+	return fmt.Sprintf("SendCDataTxInd[Status: 0x%02X, ChannelIdx: %d, DataRateIdx: %d, NumTxPackets: %d, TRXPowerLevel: %d, RFMessageAirtime: %d]", p.Status, p.ChannelIdx, p.DataRateIdx, p.NumTxPackets, p.TRXPowerLevel, p.RFMessageAirtime)
+}
+
+func (p *SendCDataTxInd) Decode(bytes []byte) error {
+	if err := checkPayloadSize(p.Code(), bytes, 1); err != nil {
+		return err
+	}
+	p.Status = bytes[0]
+	if !p.Sent() {
+		return &StatusError{Endpoint: LORAWAN_ID, Code: p.Status, MessageCode: p.Code()}
+	}
+	p.decodeTxMetadata(bytes, p.Status == LORAWAN_MSG_SEND_CDATA_TX_IND_STATUS_OK_ATTACHMENT)
+	return nil
+}
+
+func (p *SendCDataTxInd) Sent() bool {
+	return p.Status == LORAWAN_MSG_SEND_CDATA_TX_IND_STATUS_OK || p.Status == LORAWAN_MSG_SEND_CDATA_TX_IND_STATUS_OK_ATTACHMENT
+}
+
 // LORAWAN_MSG_RECV_CDATA_IND
+
+type RecvCDataInd struct {
+	wimodMessageStatusImpl
+	Ack          bool
+	FramePending bool
+	Port         byte
+	Payload      []byte
+	RxMetadata
+}
+
+func NewRecvCDataInd() *RecvCDataInd {
+	ind := &RecvCDataInd{}
+	ind.Init()
+	return ind
+}
+
+func (p *RecvCDataInd) Init() {
+	p.code = LORAWAN_MSG_RECV_CDATA_IND
+}
+
+func (p *RecvCDataInd) String() string {
+	return fmt.Sprintf("RecvCDataInd[Status: 0x%02X, Ack: %t, FramePending: %t, Port: %d, Payload: 0x%X, ChannelIdx: %d, DataRateIdx: %d, RSSI: %d, SNR: %d, RxSlot: %d]", p.Status, p.Ack, p.FramePending, p.Port, p.Payload, p.ChannelIdx, p.DataRateIdx, p.RSSI, p.SNR, p.RxSlot)
+}
+
+func (p *RecvCDataInd) Decode(bytes []byte) error {
+	if err := checkPayloadSize(p.Code(), bytes, 1); err != nil {
+		return err
+	}
+	p.Status = bytes[0]
+	p.Ack = p.Status&LORAWAN_MSG_RECV_DATA_IND_STATUS_ACK != 0
+	p.FramePending = p.Status&LORAWAN_MSG_RECV_DATA_IND_STATUS_FRAME_PENDING != 0
+	end := p.decodeRxMetadata(bytes, p.Status&LORAWAN_MSG_RECV_DATA_IND_STATUS_ATTACHMENT != 0)
+	if end > 1 {
+		p.Port = bytes[1]
+		p.Payload = append([]byte{}, bytes[2:end]...)
+	}
+	return nil
+}
+
 // LORAWAN_MSG_RECV_ACK_IND
+
+type RecvAckInd struct {
+	wimodMessageStatusImpl
+	RxMetadata
+}
+
+func NewRecvAckInd() *RecvAckInd {
+	ind := &RecvAckInd{}
+	ind.Init()
+	return ind
+}
+
+func (p *RecvAckInd) Init() {
+	p.code = LORAWAN_MSG_RECV_ACK_IND
+}
+
+func (p *RecvAckInd) String() string {
+	return fmt.Sprintf("RecvAckInd[Status: 0x%02X, ChannelIdx: %d, DataRateIdx: %d, RSSI: %d, SNR: %d, RxSlot: %d]", p.Status, p.ChannelIdx, p.DataRateIdx, p.RSSI, p.SNR, p.RxSlot)
+}
+
+func (p *RecvAckInd) Decode(bytes []byte) error {
+	if err := checkPayloadSize(p.Code(), bytes, 1); err != nil {
+		return err
+	}
+	p.Status = bytes[0]
+	p.decodeRxMetadata(bytes, p.Status&LORAWAN_MSG_RECV_DATA_IND_STATUS_ATTACHMENT != 0)
+	return nil
+}
+
 // LORAWAN_MSG_RECV_NO_DATA_IND
+
+type RecvNoDataInd struct {
+	wimodMessageStatusImpl
+	ErrorCode byte
+}
+
+func NewRecvNoDataInd() *RecvNoDataInd {
+	ind := &RecvNoDataInd{}
+	ind.Init()
+	return ind
+}
+
+func (p *RecvNoDataInd) Init() {
+	p.code = LORAWAN_MSG_RECV_NO_DATA_IND
+}
+
+func (p *RecvNoDataInd) String() string {
+	return fmt.Sprintf("RecvNoDataInd[Status: 0x%02X, ErrorCode: %08b]", p.Status, p.ErrorCode)
+}
+
+func (p *RecvNoDataInd) Decode(bytes []byte) error {
+	if err := checkPayloadSize(p.Code(), bytes, 1); err != nil {
+		return err
+	}
+	p.Status = bytes[0]
+	if p.Status&LORAWAN_MSG_RECV_NO_DATA_IND_STATUS_ERROR_CODE != 0 {
+		if err := checkPayloadSize(p.Code(), bytes, 2); err != nil {
+			return err
+		}
+		p.ErrorCode = bytes[1]
+	}
+	return nil
+}
+
 // LORAWAN_MSG_SET_RSTACK_CONFIG_REQ
+
+type RStackConfig struct {
+	DefaultDataRateIdx   byte
+	TXPowerLevel         byte
+	AdaptativeDataRate   bool
+	DutyCycleControl     bool
+	ClassC               bool
+	MACEvents            bool
+	ExtendedHCI          bool
+	AutomaticPowerSaving bool
+	MaxRetransmissions   byte
+	BandIdx              byte
+	HeaderMACCmdCapacity byte
+}
+
+func (c *RStackConfig) String() string {
+	return fmt.Sprintf("DefaultDataRateIdx: %d, TXPowerLevel: %d, AdaptativeDataRate: %t, DutyCycleControl: %t, ClassC: %t, MACEvents: %t, ExtendedHCI: %t, AutomaticPowerSaving: %t, MaxRetransmissions: %d, BandIdx: %d, HeaderMACCmdCapacity: %d", c.DefaultDataRateIdx, c.TXPowerLevel, c.AdaptativeDataRate, c.DutyCycleControl, c.ClassC, c.MACEvents, c.ExtendedHCI, c.AutomaticPowerSaving, c.MaxRetransmissions, c.BandIdx, c.HeaderMACCmdCapacity)
+}
+
+func (c *RStackConfig) encode() []byte {
+	buff := make([]byte, 7)
+	buff[0] = c.DefaultDataRateIdx
+	buff[1] = c.TXPowerLevel
+	if c.AdaptativeDataRate {
+		buff[2] |= 0x01
+	}
+	if c.DutyCycleControl {
+		buff[2] |= 0x01 << 1
+	}
+	if c.ClassC {
+		buff[2] |= 0x01 << 2
+	}
+	if c.ExtendedHCI {
+		buff[2] |= 0x01 << 6
+	}
+	if c.MACEvents {
+		buff[2] |= 0x01 << 7
+	}
+	if c.AutomaticPowerSaving {
+		buff[3] = 0x01
+	}
+	buff[4] = c.MaxRetransmissions
+	buff[5] = c.BandIdx
+	buff[6] = c.HeaderMACCmdCapacity
+	return buff
+}
+
+func (c *RStackConfig) decode(bytes []byte) {
+	c.DefaultDataRateIdx = bytes[0]
+	c.TXPowerLevel = bytes[1]
+	c.AdaptativeDataRate = bytes[2]&0x01 == 1
+	c.DutyCycleControl = (bytes[2]>>1)&0x01 == 1
+	c.ClassC = (bytes[2]>>2)&0x01 == 1
+	c.ExtendedHCI = (bytes[2]>>6)&0x01 == 1
+	c.MACEvents = (bytes[2]>>7)&0x01 == 1
+	c.AutomaticPowerSaving = bytes[3]&0x01 == 1
+	c.MaxRetransmissions = bytes[4]
+	c.BandIdx = bytes[5]
+	c.HeaderMACCmdCapacity = bytes[6]
+}
+
+type SetRStackConfigReq struct {
+	wimodMessageImpl
+	RStackConfig
+}
+
+func NewSetRStackConfigReq(config RStackConfig) *SetRStackConfigReq {
+	req := &SetRStackConfigReq{}
+	req.Init()
+	req.RStackConfig = config
+	return req
+}
+
+func (p *SetRStackConfigReq) Init() {
+	p.code = LORAWAN_MSG_SET_RSTACK_CONFIG_REQ
+}
+
+func (p *SetRStackConfigReq) String() string {
+	return fmt.Sprintf("SetRStackConfigReq[%s]", p.RStackConfig.String())
+}
+
+func (p *SetRStackConfigReq) Encode() ([]byte, error) {
+	return p.RStackConfig.encode(), nil
+}
+
 // LORAWAN_MSG_SET_RSTACK_CONFIG_RSP
+
+type SetRStackConfigResp struct {
+	wimodMessageStatusImpl
+	WrongParameter byte
+}
+
+func NewSetRStackConfigResp() *SetRStackConfigResp {
+	resp := &SetRStackConfigResp{}
+	resp.Init()
+	return resp
+}
+
+func (p *SetRStackConfigResp) Init() {
+	p.code = LORAWAN_MSG_SET_RSTACK_CONFIG_RSP
+}
+
+func (p *SetRStackConfigResp) String() string {
+	return fmt.Sprintf("SetRStackConfigResp[WrongParameter: %08b]", p.WrongParameter)
+}
+
+func (p *SetRStackConfigResp) Decode(payload []byte) error {
+	if err := checkPayloadSize(p.Code(), payload, 1); err != nil {
+		return err
+	}
+	p.Status = payload[0]
+	if p.Status == LORAWAN_STATUS_WRONG_PARAMETER && len(payload) > 1 {
+		p.WrongParameter = payload[1]
+		var wrong []string
+		if p.WrongParameter&LORAWAN_RSTACK_CONFIG_WRONG_DATA_RATE != 0 {
+			wrong = append(wrong, "data rate")
+		}
+		if p.WrongParameter&LORAWAN_RSTACK_CONFIG_WRONG_TX_POWER_LEVEL != 0 {
+			wrong = append(wrong, "tx power level")
+		}
+		if p.WrongParameter&LORAWAN_RSTACK_CONFIG_WRONG_BAND_INDEX != 0 {
+			wrong = append(wrong, "band index")
+		}
+		return fmt.Errorf("%w: %s", lorawanStatusCheck(p.Code(), p.Status), strings.Join(wrong, ", "))
+	}
+	return lorawanStatusCheck(p.Code(), p.Status)
+}
+
 // LORAWAN_MSG_GET_RSTACK_CONFIG_REQ
 
 type GetRStackConfigReq struct {
@@ -392,17 +767,7 @@ func (p *GetRStackConfigReq) Encode() ([]byte, error) {
 
 type GetRStackConfigResp struct {
 	wimodMessageStatusImpl
-	DefaultDataRateIdx   byte
-	TXPowerLevel         byte
-	AdaptativeDataRate   bool
-	DutyCycleControl     bool
-	ClassC               bool
-	MACEvents            bool
-	ExtendedHCI          bool
-	AutomaticPowerSaving bool
-	MaxRetransmissions   byte
-	BandIdx              byte
-	HeaderMACCmdCapacity byte
+	RStackConfig
 }
 
 func NewGetRStackConfigResp() *GetRStackConfigResp {
@@ -416,26 +781,22 @@ func (p *GetRStackConfigResp) Init() {
 }
 
 func (p *GetRStackConfigResp) String() string {
-	return fmt.Sprintf("GetRStackConfigResp[DefaultDataRateIdx: %d, TXPowerLevel: %d, AdaptativeDataRate: %t, DutyCycleControl: %t, ClassC: %t, MACEvents: %t, ExtendedHCI: %t, AutomaticPowerSaving: %t, MaxRetransmissions: %d, BandIdx: %d, HeaderMACCmdCapacity: %d]", p.DefaultDataRateIdx, p.TXPowerLevel, p.AdaptativeDataRate, p.DutyCycleControl, p.ClassC, p.MACEvents, p.ExtendedHCI, p.AutomaticPowerSaving, p.MaxRetransmissions, p.BandIdx, p.HeaderMACCmdCapacity)
+	return fmt.Sprintf("GetRStackConfigResp[%s]", p.RStackConfig.String())
 }
 
 func (p *GetRStackConfigResp) Decode(payload []byte) error {
+	if err := checkPayloadSize(p.Code(), payload, 1); err != nil {
+		return err
+	}
 	p.Status = payload[0]
-	err := lorawanStatusCheck(p.Status)
+	err := lorawanStatusCheck(p.Code(), p.Status)
 	if err != nil {
 		return err
 	}
-	p.DefaultDataRateIdx = payload[1]
-	p.TXPowerLevel = payload[2]
-	p.AdaptativeDataRate = payload[3]&0x01 == 1
-	p.DutyCycleControl = (payload[3]>>1)&0x01 == 1
-	p.ClassC = (payload[3]>>2)&0x01 == 1
-	p.MACEvents = (payload[3]>>6)&0x01 == 1
-	p.ExtendedHCI = (payload[3]>>7)&0x01 == 1
-	p.AutomaticPowerSaving = payload[4]&0x01 == 1
-	p.MaxRetransmissions = payload[5]
-	p.BandIdx = payload[6]
-	p.HeaderMACCmdCapacity = payload[7]
+	if err := checkPayloadSize(p.Code(), payload, 8); err != nil {
+		return err
+	}
+	p.RStackConfig.decode(payload[1:8])
 	return nil
 }
 
@@ -485,11 +846,17 @@ func (p *ReactivateDeviceResp) String() string {
 }
 
 func (p *ReactivateDeviceResp) Decode(payload []byte) error {
+	if err := checkPayloadSize(p.Code(), payload, 1); err != nil {
+		return err
+	}
 	p.Status = payload[0]
-	err := lorawanStatusCheck(p.Status)
+	err := lorawanStatusCheck(p.Code(), p.Status)
 	if err != nil {
 		return err
 	}
+	if err := checkPayloadSize(p.Code(), payload, 5); err != nil {
+		return err
+	}
 	p.Address = binary.LittleEndian.Uint32(payload[1:5])
 	return nil
 }
@@ -539,66 +906,177 @@ func (p *DeactivateDeviceResp) String() string {
 }
 
 func (p *DeactivateDeviceResp) Decode(payload []byte) error {
+	if err := checkPayloadSize(p.Code(), payload, 1); err != nil {
+		return err
+	}
 	p.Status = payload[0]
-	return lorawanStatusCheck(p.Status)
+	return lorawanStatusCheck(p.Code(), p.Status)
 }
 
 // LORAWAN_MSG_FACTORY_RESET_REQ
-// LORAWAN_MSG_FACTORY_RESET_RSP
-// LORAWAN_MSG_SET_DEVICE_EUI_REQ
-// LORAWAN_MSG_SET_DEVICE_EUI_RSP
-// LORAWAN_MSG_GET_DEVICE_EUI_REQ
 
-type GetDeviceEUIReq struct {
+type FactoryResetReq struct {
 	wimodMessageImpl
 }
 
-func NewGetDeviceEUIReq() *GetDeviceEUIReq {
-	req := &GetDeviceEUIReq{}
+func NewFactoryResetReq() *FactoryResetReq {
+	req := &FactoryResetReq{}
 	req.Init()
 	return req
 }
 
-func (p *GetDeviceEUIReq) Init() {
-	p.code = LORAWAN_MSG_GET_DEVICE_EUI_REQ
+func (p *FactoryResetReq) Init() {
+	p.code = LORAWAN_MSG_FACTORY_RESET_REQ
 }
 
-func (p *GetDeviceEUIReq) String() string {
-	return fmt.Sprintf("GetDeviceEUIReq[]")
+func (p *FactoryResetReq) String() string {
+	return fmt.Sprintf("FactoryResetReq[]")
 }
 
-func (p *GetDeviceEUIReq) Encode() ([]byte, error) {
+func (p *FactoryResetReq) Encode() ([]byte, error) {
 	return []byte{}, nil
 }
 
-// LORAWAN_MSG_GET_DEVICE_EUI_RSP
+// LORAWAN_MSG_FACTORY_RESET_RSP
 
-type GetDeviceEUIResp struct {
+type FactoryResetResp struct {
 	wimodMessageStatusImpl
-	EUI EUI
 }
 
-func NewGetDeviceEUIResp() *GetDeviceEUIResp {
-	resp := &GetDeviceEUIResp{}
+func NewFactoryResetResp() *FactoryResetResp {
+	resp := &FactoryResetResp{}
 	resp.Init()
 	return resp
 }
 
-func (p *GetDeviceEUIResp) Init() {
-	p.code = LORAWAN_MSG_GET_DEVICE_EUI_RSP
+func (p *FactoryResetResp) Init() {
+	p.code = LORAWAN_MSG_FACTORY_RESET_RSP
 }
 
-func (p *GetDeviceEUIResp) String() string {
-	return fmt.Sprintf("GetDeviceEUIResp[EUI: %v]", p.EUI)
+func (p *FactoryResetResp) String() string {
+	return fmt.Sprintf("FactoryResetResp[]")
+}
+
+func (p *FactoryResetResp) Decode(payload []byte) error {
+	if err := checkPayloadSize(p.Code(), payload, 1); err != nil {
+		return err
+	}
+	p.Status = payload[0]
+	return lorawanStatusCheck(p.Code(), p.Status)
+}
+
+// LORAWAN_MSG_SET_DEVICE_EUI_REQ
+
+type SetDeviceEUIReq struct {
+	wimodMessageImpl
+	EUI EUI
+}
+
+func NewSetDeviceEUIReq(eui EUI) *SetDeviceEUIReq {
+	req := &SetDeviceEUIReq{}
+	req.Init()
+	req.EUI = eui
+	return req
+}
+
+func (p *SetDeviceEUIReq) Init() {
+	p.code = LORAWAN_MSG_SET_DEVICE_EUI_REQ
+}
+
+func (p *SetDeviceEUIReq) String() string {
+	return fmt.Sprintf("SetDeviceEUIReq[EUI: %v]", p.EUI)
+}
+
+func (p *SetDeviceEUIReq) Encode() ([]byte, error) {
+	return EncodeEUI(&p.EUI), nil
+}
+
+// LORAWAN_MSG_SET_DEVICE_EUI_RSP
+
+type SetDeviceEUIResp struct {
+	wimodMessageStatusImpl
+}
+
+func NewSetDeviceEUIResp() *SetDeviceEUIResp {
+	resp := &SetDeviceEUIResp{}
+	resp.Init()
+	return resp
+}
+
+func (p *SetDeviceEUIResp) Init() {
+	p.code = LORAWAN_MSG_SET_DEVICE_EUI_RSP
+}
+
+func (p *SetDeviceEUIResp) String() string {
+	return fmt.Sprintf("SetDeviceEUIResp[]")
+}
+
+func (p *SetDeviceEUIResp) Decode(payload []byte) error {
+	if err := checkPayloadSize(p.Code(), payload, 1); err != nil {
+		return err
+	}
+	p.Status = payload[0]
+	return lorawanStatusCheck(p.Code(), p.Status)
+}
+
+// LORAWAN_MSG_GET_DEVICE_EUI_REQ
+
+type GetDeviceEUIReq struct {
+	wimodMessageImpl
+}
+
+func NewGetDeviceEUIReq() *GetDeviceEUIReq {
+	req := &GetDeviceEUIReq{}
+	req.Init()
+	return req
+}
+
+func (p *GetDeviceEUIReq) Init() {
+	p.code = LORAWAN_MSG_GET_DEVICE_EUI_REQ
+}
+
+func (p *GetDeviceEUIReq) String() string {
+	return fmt.Sprintf("GetDeviceEUIReq[]")
+}
+
+func (p *GetDeviceEUIReq) Encode() ([]byte, error) {
+	return []byte{}, nil
+}
+
+// LORAWAN_MSG_GET_DEVICE_EUI_RSP
+
+type GetDeviceEUIResp struct {
+	wimodMessageStatusImpl
+	EUI EUI
+}
+
+func NewGetDeviceEUIResp() *GetDeviceEUIResp {
+	resp := &GetDeviceEUIResp{}
+	resp.Init()
+	return resp
+}
+
+func (p *GetDeviceEUIResp) Init() {
+	p.code = LORAWAN_MSG_GET_DEVICE_EUI_RSP
+}
+
+func (p *GetDeviceEUIResp) String() string {
+	return fmt.Sprintf("GetDeviceEUIResp[EUI: %v]", p.EUI)
 }
 
 func (p *GetDeviceEUIResp) Decode(payload []byte) error {
+	if err := checkPayloadSize(p.Code(), payload, 1); err != nil {
+		return err
+	}
 	p.Status = payload[0]
-	err := lorawanStatusCheck(payload[0])
+	err := lorawanStatusCheck(p.Code(), p.Status)
 	if err != nil {
 		return err
 	}
-	p.EUI = DecodeEUI(payload[1:])
+	if err := checkPayloadSize(p.Code(), payload, 9); err != nil {
+		return err
+	}
+	p.EUI = DecodeEUI(payload[1:9])
 	return nil
 }
 
@@ -652,13 +1130,22 @@ func (p *GetNwkStatusResp) String() string {
 }
 
 func (p *GetNwkStatusResp) Decode(payload []byte) error {
+	if err := checkPayloadSize(p.Code(), payload, 1); err != nil {
+		return err
+	}
 	p.Status = payload[0]
-	err := lorawanStatusCheck(p.Status)
+	err := lorawanStatusCheck(p.Code(), p.Status)
 	if err != nil {
 		return err
 	}
+	if err := checkPayloadSize(p.Code(), payload, 2); err != nil {
+		return err
+	}
 	p.NetworkStatus = payload[1]
 	if p.NetworkStatus == LORAWAN_NETWORK_STATUS_ACTIVE_ABP || p.NetworkStatus == LORAWAN_NETWORK_STATUS_ACTIVE_OTAA {
+		if err := checkPayloadSize(p.Code(), payload, 9); err != nil {
+			return err
+		}
 		p.Address = binary.LittleEndian.Uint32(payload[2:6])
 		p.DataRateIdx = payload[6]
 		p.PowerLevel = payload[7]
@@ -668,15 +1155,395 @@ func (p *GetNwkStatusResp) Decode(payload []byte) error {
 }
 
 // LORAWAN_MSG_SEND_MAC_CMD_REQ
+
+type SendMACCmdReq struct {
+	wimodMessageImpl
+	Confirmed bool
+	CID       byte
+	Options   []byte
+}
+
+func NewSendMACCmdReq(confirmed bool, cmd mac.Command) *SendMACCmdReq {
+	req := &SendMACCmdReq{}
+	req.Init()
+	req.Confirmed = confirmed
+	req.CID = cmd.CID()
+	req.Options = cmd.Encode()
+	return req
+}
+
+func (p *SendMACCmdReq) Init() {
+	p.code = LORAWAN_MSG_SEND_MAC_CMD_REQ
+}
+
+func (p *SendMACCmdReq) String() string {
+	return fmt.Sprintf("SendMACCmdReq[Confirmed: %t, CID: 0x%02X, Options: 0x%X]", p.Confirmed, p.CID, p.Options)
+}
+
+func (p *SendMACCmdReq) Encode() ([]byte, error) {
+	serviceType := LORAWAN_MAC_CMD_SERVICE_UNRELIABLE
+	if p.Confirmed {
+		serviceType = LORAWAN_MAC_CMD_SERVICE_RELIABLE
+	}
+	return append([]byte{serviceType, p.CID}, p.Options...), nil
+}
+
 // LORAWAN_MSG_SEND_MAC_CMD_RSP
+
+type SendMACCmdResp struct {
+	wimodMessageStatusImpl
+}
+
+func NewSendMACCmdResp() *SendMACCmdResp {
+	resp := &SendMACCmdResp{}
+	resp.Init()
+	return resp
+}
+
+func (p *SendMACCmdResp) Init() {
+	p.code = LORAWAN_MSG_SEND_MAC_CMD_RSP
+}
+
+func (p *SendMACCmdResp) String() string {
+	return fmt.Sprintf("SendMACCmdResp[Status: 0x%02X]", p.Status)
+}
+
+func (p *SendMACCmdResp) Decode(payload []byte) error {
+	if err := checkPayloadSize(p.Code(), payload, 1); err != nil {
+		return err
+	}
+	p.Status = payload[0]
+	return lorawanStatusCheck(p.Code(), p.Status)
+}
+
 // LORAWAN_MSG_RECV_MAC_CMD_IND
+
+type RecvMACCmdInd struct {
+	wimodMessageStatusImpl
+	MACCommands []byte
+	RxMetadata
+}
+
+func NewRecvMACCmdInd() *RecvMACCmdInd {
+	ind := &RecvMACCmdInd{}
+	ind.Init()
+	return ind
+}
+
+func (p *RecvMACCmdInd) Init() {
+	p.code = LORAWAN_MSG_RECV_MAC_CMD_IND
+}
+
+func (p *RecvMACCmdInd) String() string {
+	return fmt.Sprintf("RecvMACCmdInd[Status: 0x%02X, MACCommands: 0x%X, ChannelIdx: %d, DataRateIdx: %d, RSSI: %d, SNR: %d, RxSlot: %d]", p.Status, p.MACCommands, p.ChannelIdx, p.DataRateIdx, p.RSSI, p.SNR, p.RxSlot)
+}
+
+func (p *RecvMACCmdInd) Decode(bytes []byte) error {
+	if err := checkPayloadSize(p.Code(), bytes, 1); err != nil {
+		return err
+	}
+	p.Status = bytes[0]
+	end := p.decodeRxMetadata(bytes, p.Status&LORAWAN_MSG_RECV_MAC_CMD_IND_STATUS_ATTACHMENT != 0)
+	p.MACCommands = append([]byte{}, bytes[1:end]...)
+	return nil
+}
+
+func (p *RecvMACCmdInd) Commands() ([]mac.Command, error) {
+	return mac.DecodeDownlink(p.MACCommands)
+}
+
 // LORAWAN_MSG_SET_CUSTOM_CFG_REQ
+
+type SetCustomCfgReq struct {
+	wimodMessageImpl
+	RFGain int8
+}
+
+func NewSetCustomCfgReq(rfGain int8) *SetCustomCfgReq {
+	req := &SetCustomCfgReq{}
+	req.Init()
+	req.RFGain = rfGain
+	return req
+}
+
+func (p *SetCustomCfgReq) Init() {
+	p.code = LORAWAN_MSG_SET_CUSTOM_CFG_REQ
+}
+
+func (p *SetCustomCfgReq) String() string {
+	return fmt.Sprintf("SetCustomCfgReq[RFGain: %d]", p.RFGain)
+}
+
+func (p *SetCustomCfgReq) Encode() ([]byte, error) {
+	return []byte{byte(p.RFGain)}, nil
+}
+
 // LORAWAN_MSG_SET_CUSTOM_CFG_RSP
+
+type SetCustomCfgResp struct {
+	wimodMessageStatusImpl
+}
+
+func NewSetCustomCfgResp() *SetCustomCfgResp {
+	resp := &SetCustomCfgResp{}
+	resp.Init()
+	return resp
+}
+
+func (p *SetCustomCfgResp) Init() {
+	p.code = LORAWAN_MSG_SET_CUSTOM_CFG_RSP
+}
+
+func (p *SetCustomCfgResp) String() string {
+	return fmt.Sprintf("SetCustomCfgResp[Status: 0x%02X]", p.Status)
+}
+
+func (p *SetCustomCfgResp) Decode(payload []byte) error {
+	if err := checkPayloadSize(p.Code(), payload, 1); err != nil {
+		return err
+	}
+	p.Status = payload[0]
+	return lorawanStatusCheck(p.Code(), p.Status)
+}
+
 // LORAWAN_MSG_GET_CUSTOM_CFG_REQ
+
+type GetCustomCfgReq struct {
+	wimodMessageImpl
+}
+
+func NewGetCustomCfgReq() *GetCustomCfgReq {
+	req := &GetCustomCfgReq{}
+	req.Init()
+	return req
+}
+
+func (p *GetCustomCfgReq) Init() {
+	p.code = LORAWAN_MSG_GET_CUSTOM_CFG_REQ
+}
+
+func (p *GetCustomCfgReq) String() string {
+	return fmt.Sprintf("GetCustomCfgReq[]")
+}
+
+func (p *GetCustomCfgReq) Encode() ([]byte, error) {
+	return []byte{}, nil
+}
+
 // LORAWAN_MSG_GET_CUSTOM_CFG_RSP
+
+type GetCustomCfgResp struct {
+	wimodMessageStatusImpl
+	RFGain int8
+}
+
+func NewGetCustomCfgResp() *GetCustomCfgResp {
+	resp := &GetCustomCfgResp{}
+	resp.Init()
+	return resp
+}
+
+func (p *GetCustomCfgResp) Init() {
+	p.code = LORAWAN_MSG_GET_CUSTOM_CFG_RSP
+}
+
+func (p *GetCustomCfgResp) String() string {
+	return fmt.Sprintf("GetCustomCfgResp[Status: 0x%02X, RFGain: %d]", p.Status, p.RFGain)
+}
+
+func (p *GetCustomCfgResp) Decode(payload []byte) error {
+	if err := checkPayloadSize(p.Code(), payload, 1); err != nil {
+		return err
+	}
+	p.Status = payload[0]
+	err := lorawanStatusCheck(p.Code(), p.Status)
+	if err != nil {
+		return err
+	}
+	if err := checkPayloadSize(p.Code(), payload, 2); err != nil {
+		return err
+	}
+	p.RFGain = int8(payload[1])
+	return nil
+}
+
 // LORAWAN_MSG_GET_SUPPORTED_BANDS_REQ
+
+type GetSupportedBandsReq struct {
+	wimodMessageImpl
+}
+
+func NewGetSupportedBandsReq() *GetSupportedBandsReq {
+	req := &GetSupportedBandsReq{}
+	req.Init()
+	return req
+}
+
+func (p *GetSupportedBandsReq) Init() {
+	p.code = LORAWAN_MSG_GET_SUPPORTED_BANDS_REQ
+}
+
+func (p *GetSupportedBandsReq) String() string {
+	return fmt.Sprintf("GetSupportedBandsReq[]")
+}
+
+func (p *GetSupportedBandsReq) Encode() ([]byte, error) {
+	return []byte{}, nil
+}
+
 // LORAWAN_MSG_GET_SUPPORTED_BANDS_RSP
+
+type SupportedBand struct {
+	BandIdx byte
+	MaxEIRP byte
+}
+
+type GetSupportedBandsResp struct {
+	wimodMessageStatusImpl
+	Bands []SupportedBand
+}
+
+func NewGetSupportedBandsResp() *GetSupportedBandsResp {
+	resp := &GetSupportedBandsResp{}
+	resp.Init()
+	return resp
+}
+
+func (p *GetSupportedBandsResp) Init() {
+	p.code = LORAWAN_MSG_GET_SUPPORTED_BANDS_RSP
+}
+
+func (p *GetSupportedBandsResp) String() string {
+	return fmt.Sprintf("GetSupportedBandsResp[Status: 0x%02X, Bands: %v]", p.Status, p.Bands)
+}
+
+func (p *GetSupportedBandsResp) Decode(payload []byte) error {
+	if err := checkPayloadSize(p.Code(), payload, 1); err != nil {
+		return err
+	}
+	p.Status = payload[0]
+	err := lorawanStatusCheck(p.Code(), p.Status)
+	if err != nil {
+		return err
+	}
+	p.Bands = []SupportedBand{}
+	for i := 1; i+1 < len(payload); i += 2 {
+		p.Bands = append(p.Bands, SupportedBand{payload[i], payload[i+1]})
+	}
+	return nil
+}
+
 // LORAWAN_MSG_SET_LINKADRREQ_CONFIG_REQ
+
+type SetLinkADRReqConfigReq struct {
+	wimodMessageImpl
+	Option byte
+}
+
+func NewSetLinkADRReqConfigReq(option byte) *SetLinkADRReqConfigReq {
+	req := &SetLinkADRReqConfigReq{}
+	req.Init()
+	req.Option = option
+	return req
+}
+
+func (p *SetLinkADRReqConfigReq) Init() {
+	p.code = LORAWAN_MSG_SET_LINKADRREQ_CONFIG_REQ
+}
+
+func (p *SetLinkADRReqConfigReq) String() string {
+	return fmt.Sprintf("SetLinkADRReqConfigReq[Option: %d]", p.Option)
+}
+
+func (p *SetLinkADRReqConfigReq) Encode() ([]byte, error) {
+	return []byte{p.Option}, nil
+}
+
 // LORAWAN_MSG_SET_LINKADRREQ_CONFIG_RSP
+
+type SetLinkADRReqConfigResp struct {
+	wimodMessageStatusImpl
+}
+
+func NewSetLinkADRReqConfigResp() *SetLinkADRReqConfigResp {
+	resp := &SetLinkADRReqConfigResp{}
+	resp.Init()
+	return resp
+}
+
+func (p *SetLinkADRReqConfigResp) Init() {
+	p.code = LORAWAN_MSG_SET_LINKADRREQ_CONFIG_RSP
+}
+
+func (p *SetLinkADRReqConfigResp) String() string {
+	return fmt.Sprintf("SetLinkADRReqConfigResp[Status: 0x%02X]", p.Status)
+}
+
+func (p *SetLinkADRReqConfigResp) Decode(payload []byte) error {
+	if err := checkPayloadSize(p.Code(), payload, 1); err != nil {
+		return err
+	}
+	p.Status = payload[0]
+	return lorawanStatusCheck(p.Code(), p.Status)
+}
+
 // LORAWAN_MSG_GET_LINKADRREQ_CONFIG_REQ
+
+type GetLinkADRReqConfigReq struct {
+	wimodMessageImpl
+}
+
+func NewGetLinkADRReqConfigReq() *GetLinkADRReqConfigReq {
+	req := &GetLinkADRReqConfigReq{}
+	req.Init()
+	return req
+}
+
+func (p *GetLinkADRReqConfigReq) Init() {
+	p.code = LORAWAN_MSG_GET_LINKADRREQ_CONFIG_REQ
+}
+
+func (p *GetLinkADRReqConfigReq) String() string {
+	return fmt.Sprintf("GetLinkADRReqConfigReq[]")
+}
+
+func (p *GetLinkADRReqConfigReq) Encode() ([]byte, error) {
+	return []byte{}, nil
+}
+
 // LORAWAN_MSG_GET_LINKADRREQ_CONFIG_RSP
+
+type GetLinkADRReqConfigResp struct {
+	wimodMessageStatusImpl
+	Option byte
+}
+
+func NewGetLinkADRReqConfigResp() *GetLinkADRReqConfigResp {
+	resp := &GetLinkADRReqConfigResp{}
+	resp.Init()
+	return resp
+}
+
+func (p *GetLinkADRReqConfigResp) Init() {
+	p.code = LORAWAN_MSG_GET_LINKADRREQ_CONFIG_RSP
+}
+
+func (p *GetLinkADRReqConfigResp) String() string {
+	return fmt.Sprintf("GetLinkADRReqConfigResp[Status: 0x%02X, Option: %d]", p.Status, p.Option)
+}
+
+func (p *GetLinkADRReqConfigResp) Decode(payload []byte) error {
+	if err := checkPayloadSize(p.Code(), payload, 1); err != nil {
+		return err
+	}
+	p.Status = payload[0]
+	err := lorawanStatusCheck(p.Code(), p.Status)
+	if err != nil {
+		return err
+	}
+	if err := checkPayloadSize(p.Code(), payload, 2); err != nil {
+		return err
+	}
+	p.Option = payload[1]
+	return nil
+}
@@ -1,47 +1,212 @@
 package wimod
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
 
-func devMgmtStatusCheck(status byte) error {
-	switch status {
-	case DEVMGMT_STATUS_OK:
+// StatusError reports a request refused by the modem, or an indication
+// reporting a failure, with status Code in the service access point Endpoint,
+// DEVMGMT_ID or LORAWAN_ID. RemainingTime is set for CHANNEL_BLOCKED.
+type StatusError struct {
+	Endpoint      byte
+	Code          byte
+	MessageCode   uint16
+	RemainingTime uint32
+}
+
+// The sentinels match any StatusError with the same Endpoint and Code, for
+// errors.Is, but those of the indications with status codes of their own.
+var (
+	ErrDevMgmtError           = &StatusError{Endpoint: DEVMGMT_ID, Code: DEVMGMT_STATUS_ERROR}
+	ErrDevMgmtCmdNotSupported = &StatusError{Endpoint: DEVMGMT_ID, Code: DEVMGMT_STATUS_CMD_NOT_SUPPORTED}
+	ErrDevMgmtWrongParameter  = &StatusError{Endpoint: DEVMGMT_ID, Code: DEVMGMT_STATUS_WRONG_PARAMETER}
+	ErrLoRaWANError           = &StatusError{Endpoint: LORAWAN_ID, Code: LORAWAN_STATUS_ERROR}
+	ErrLoRaWANCmdNotSupported = &StatusError{Endpoint: LORAWAN_ID, Code: LORAWAN_STATUS_CMD_NOT_SUPPORTED}
+	ErrLoRaWANWrongParameter  = &StatusError{Endpoint: LORAWAN_ID, Code: LORAWAN_STATUS_WRONG_PARAMETER}
+	ErrWrongDeviceMode        = &StatusError{Endpoint: LORAWAN_ID, Code: LORAWAN_STATUS_WRONG_DEVICE_MODE}
+	ErrDeviceNotActivated     = &StatusError{Endpoint: LORAWAN_ID, Code: LORAWAN_STATUS_DEVICE_NOT_ACTIVATED}
+	ErrDeviceBusy             = &StatusError{Endpoint: LORAWAN_ID, Code: LORAWAN_STATUS_DEVICE_BUSY}
+	ErrQueueFull              = &StatusError{Endpoint: LORAWAN_ID, Code: LORAWAN_STATUS_QUEUE_FULL}
+	ErrLengthError            = &StatusError{Endpoint: LORAWAN_ID, Code: LORAWAN_STATUS_LENGTH_ERROR}
+	ErrNoFactorySettings      = &StatusError{Endpoint: LORAWAN_ID, Code: LORAWAN_STATUS_NO_FACTORY_SETTINGS}
+	ErrChannelBlocked         = &StatusError{Endpoint: LORAWAN_ID, Code: LORAWAN_STATUS_CHANNEL_BLOCKED}
+	ErrChannelNotAvailable    = &StatusError{Endpoint: LORAWAN_ID, Code: LORAWAN_STATUS_CHANNEL_NOT_AVAILABLE}
+	ErrSendUDataTxError       = &StatusError{Endpoint: LORAWAN_ID, Code: LORAWAN_MSG_SEND_UDATA_TX_IND_STATUS_ERROR, MessageCode: LORAWAN_MSG_SEND_UDATA_TX_IND}
+	ErrMaxRetransmissions     = &StatusError{Endpoint: LORAWAN_ID, Code: LORAWAN_MSG_SEND_CDATA_TX_IND_STATUS_MAX_RETRANSMISSIONS, MessageCode: LORAWAN_MSG_SEND_CDATA_TX_IND}
+	ErrMaxPayloadSize         = &StatusError{Endpoint: LORAWAN_ID, Code: LORAWAN_MSG_SEND_CDATA_TX_IND_STATUS_MAX_PAYLOAD_SIZE, MessageCode: LORAWAN_MSG_SEND_CDATA_TX_IND}
+)
+
+var statusNames = map[byte]map[byte]string{
+	DEVMGMT_ID: {
+		DEVMGMT_STATUS_ERROR:             "DEVMGMT_STATUS_ERROR",
+		DEVMGMT_STATUS_CMD_NOT_SUPPORTED: "DEVMGMT_STATUS_CMD_NOT_SUPPORTED",
+		DEVMGMT_STATUS_WRONG_PARAMETER:   "DEVMGMT_STATUS_WRONG_PARAMETER",
+	},
+	LORAWAN_ID: {
+		LORAWAN_STATUS_ERROR:                 "LORAWAN_STATUS_ERROR",
+		LORAWAN_STATUS_CMD_NOT_SUPPORTED:     "LORAWAN_STATUS_CMD_NOT_SUPPORTED",
+		LORAWAN_STATUS_WRONG_PARAMETER:       "LORAWAN_STATUS_WRONG_PARAMETER",
+		LORAWAN_STATUS_WRONG_DEVICE_MODE:     "LORAWAN_STATUS_WRONG_DEVICE_MODE",
+		LORAWAN_STATUS_DEVICE_NOT_ACTIVATED:  "LORAWAN_STATUS_DEVICE_NOT_ACTIVATED",
+		LORAWAN_STATUS_DEVICE_BUSY:           "LORAWAN_STATUS_DEVICE_BUSY",
+		LORAWAN_STATUS_QUEUE_FULL:            "LORAWAN_STATUS_QUEUE_FULL",
+		LORAWAN_STATUS_LENGTH_ERROR:          "LORAWAN_STATUS_LENGTH_ERROR",
+		LORAWAN_STATUS_NO_FACTORY_SETTINGS:   "LORAWAN_STATUS_NO_FACTORY_SETTINGS",
+		LORAWAN_STATUS_CHANNEL_BLOCKED:       "LORAWAN_STATUS_CHANNEL_BLOCKED",
+		LORAWAN_STATUS_CHANNEL_NOT_AVAILABLE: "LORAWAN_STATUS_CHANNEL_NOT_AVAILABLE",
+	},
+}
+
+// indStatusNames holds the indications whose status codes are their own rather
+// than those of the endpoint.
+var indStatusNames = map[uint16]map[byte]string{
+	LORAWAN_MSG_SEND_UDATA_TX_IND: {
+		LORAWAN_MSG_SEND_UDATA_TX_IND_STATUS_ERROR: "LORAWAN_MSG_SEND_UDATA_TX_IND_STATUS_ERROR",
+	},
+	LORAWAN_MSG_SEND_CDATA_TX_IND: {
+		LORAWAN_MSG_SEND_CDATA_TX_IND_STATUS_MAX_RETRANSMISSIONS: "LORAWAN_MSG_SEND_CDATA_TX_IND_STATUS_MAX_RETRANSMISSIONS",
+		LORAWAN_MSG_SEND_CDATA_TX_IND_STATUS_MAX_PAYLOAD_SIZE:    "LORAWAN_MSG_SEND_CDATA_TX_IND_STATUS_MAX_PAYLOAD_SIZE",
+	},
+}
+
+// StatusName returns the name of a status code, or its value in hex if it is
+// unknown.
+func StatusName(endpoint byte, code byte) string {
+	if name, ok := statusNames[endpoint][code]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%02X", code)
+}
+
+func (e *StatusError) Error() string {
+	msg := e.statusName()
+	if e.MessageCode != 0 {
+		msg = MessageName(e.MessageCode) + ": " + msg
+	}
+	if e.Code == LORAWAN_STATUS_CHANNEL_BLOCKED && e.Endpoint == LORAWAN_ID {
+		msg += fmt.Sprintf(", remaining time %d ms", e.RemainingTime)
+	}
+	return msg
+}
+
+func (e *StatusError) statusName() string {
+	if names, ok := indStatusNames[e.MessageCode]; ok {
+		if name, ok := names[e.Code]; ok {
+			return name
+		}
+		return fmt.Sprintf("0x%02X", e.Code)
+	}
+	return StatusName(e.Endpoint, e.Code)
+}
+
+func (e *StatusError) Is(target error) bool {
+	t, ok := target.(*StatusError)
+	if !ok || t.Endpoint != e.Endpoint || t.Code != e.Code {
+		return false
+	}
+	if t.MessageCode == 0 {
+		_, own := indStatusNames[e.MessageCode]
+		return !own
+	}
+	return t.MessageCode == e.MessageCode
+}
+
+// ParseStatusError parses the text of a StatusError with a MessageCode, as
+// left by boundaries that only keep the error message, like net/rpc. It also
+// returns the text that followed it, if the StatusError had been wrapped.
+func ParseStatusError(s string) (*StatusError, string, bool) {
+	name, rest, ok := strings.Cut(s, ": ")
+	if !ok {
+		return nil, "", false
+	}
+	e := &StatusError{}
+	if e.MessageCode, ok = parseMessageName(name); !ok {
+		return nil, "", false
+	}
+	e.Endpoint = byte(e.MessageCode >> 8)
+	end := strings.IndexAny(rest, ",:")
+	if end < 0 {
+		end = len(rest)
+	}
+	if e.Code, ok = parseStatusName(e.Endpoint, e.MessageCode, rest[:end]); !ok {
+		return nil, "", false
+	}
+	rest = rest[end:]
+	if e.Code == LORAWAN_STATUS_CHANNEL_BLOCKED && e.Endpoint == LORAWAN_ID {
+		remaining, after, ok := strings.Cut(strings.TrimPrefix(rest, ", remaining time "), " ms")
+		ms, err := strconv.ParseUint(remaining, 10, 32)
+		if !ok || err != nil {
+			return nil, "", false
+		}
+		e.RemainingTime = uint32(ms)
+		rest = after
+	}
+	return e, rest, true
+}
+
+func parseMessageName(name string) (uint16, bool) {
+	for code, n := range messageNames {
+		if n == name {
+			return code, true
+		}
+	}
+	code, err := strconv.ParseUint(name, 0, 16)
+	return uint16(code), err == nil
+}
+
+func parseStatusName(endpoint byte, messageCode uint16, name string) (byte, bool) {
+	names, ok := indStatusNames[messageCode]
+	if !ok {
+		names = statusNames[endpoint]
+	}
+	for code, n := range names {
+		if n == name {
+			return code, true
+		}
+	}
+	code, err := strconv.ParseUint(name, 0, 8)
+	return byte(code), err == nil
+}
+
+func devMgmtStatusCheck(messageCode uint16, status byte) error {
+	if status == DEVMGMT_STATUS_OK {
 		return nil
-	case DEVMGMT_STATUS_ERROR:
-		return fmt.Errorf("DEVMGMT_STATUS_ERROR")
-	case DEVMGMT_STATUS_CMD_NOT_SUPPORTED:
-		return fmt.Errorf("DEVMGMT_STATUS_ERROR")
-	case DEVMGMT_STATUS_WRONG_PARAMETER:
-		return fmt.Errorf("DEVMGMT_STATUS_ERROR")
 	}
-	return fmt.Errorf("UNKNOWN_DEVMGMT_ERROR")
+	return &StatusError{Endpoint: DEVMGMT_ID, Code: status, MessageCode: messageCode}
 }
 
-func lorawanStatusCheck(status byte) error {
-	switch status {
-	case LORAWAN_STATUS_OK:
+func lorawanStatusCheck(messageCode uint16, status byte) error {
+	if status == LORAWAN_STATUS_OK {
 		return nil
-	case LORAWAN_STATUS_ERROR:
-		return fmt.Errorf("LORAWAN_STATUS_ERROR")
-	case LORAWAN_STATUS_CMD_NOT_SUPPORTED:
-		return fmt.Errorf("LORAWAN_STATUS_CMD_NOT_SUPPORTED")
-	case LORAWAN_STATUS_WRONG_PARAMETER:
-		return fmt.Errorf("LORAWAN_STATUS_WRONG_PARAMETER")
-	case LORAWAN_STATUS_WRONG_DEVICE_MODE:
-		return fmt.Errorf("LORAWAN_STATUS_WRONG_DEVICE_MODE")
-	case LORAWAN_STATUS_DEVICE_NOT_ACTIVATED:
-		return fmt.Errorf("LORAWAN_STATUS_DEVICE_NOT_ACTIVATED")
-	case LORAWAN_STATUS_DEVICE_BUSY:
-		return fmt.Errorf("LORAWAN_STATUS_DEVICE_BUSY")
-	case LORAWAN_STATUS_QUEUE_FULL:
-		return fmt.Errorf("LORAWAN_STATUS_QUEUE_FULL")
-	case LORAWAN_STATUS_LENGTH_ERROR:
-		return fmt.Errorf("LORAWAN_STATUS_LENGTH_ERROR")
-	case LORAWAN_STATUS_NO_FACTORY_SETTINGS:
-		return fmt.Errorf("LORAWAN_STATUS_NO_FACTORY_SETTINGS")
-	case LORAWAN_STATUS_CHANNEL_BLOCKED:
-		return fmt.Errorf("LORAWAN_STATUS_CHANNEL_BLOCKED")
-	case LORAWAN_STATUS_CHANNEL_NOT_AVAILABLE:
-		return fmt.Errorf("LORAWAN_STATUS_CHANNEL_NOT_AVAILABLE")
-	}
-	return fmt.Errorf("UNKNOWN_LORAWAN_ERROR")
+	}
+	return &StatusError{Endpoint: LORAWAN_ID, Code: status, MessageCode: messageCode}
+}
+
+var ErrShortPayload = errors.New("short payload")
+
+// ShortPayloadError reports a message payload of Actual bytes where at least
+// Expected were needed to decode it.
+type ShortPayloadError struct {
+	Code     uint16
+	Expected int
+	Actual   int
+}
+
+func (e *ShortPayloadError) Error() string {
+	return fmt.Sprintf("%s: %s, expected %d bytes, got %d", MessageName(e.Code), ErrShortPayload, e.Expected, e.Actual)
+}
+
+func (e *ShortPayloadError) Is(target error) bool {
+	return target == ErrShortPayload
+}
+
+// checkPayloadSize returns a *ShortPayloadError if payload is shorter than size.
+func checkPayloadSize(code uint16, payload []byte, size int) error {
+	if len(payload) < size {
+		return &ShortPayloadError{Code: code, Expected: size, Actual: len(payload)}
+	}
+	return nil
 }
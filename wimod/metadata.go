@@ -0,0 +1,82 @@
+package wimod
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+const (
+	rxMetadataSize = 5
+	txMetadataSize = 8
+)
+
+// RxMetadata holds the Rx channel info the modem attaches to received radio
+// packets when the extended HCI output format is enabled. ReceivedAt is the
+// host time at which the indication was decoded, the modem does not report one.
+type RxMetadata struct {
+	Attached    bool
+	ChannelIdx  byte
+	DataRateIdx byte
+	RSSI        int8
+	SNR         int8
+	RxSlot      byte
+	ReceivedAt  time.Time
+}
+
+func (m *RxMetadata) RxInfo() *RxMetadata {
+	return m
+}
+
+// decodeRxMetadata decodes the attachment found at the end of bytes and
+// returns the offset where it starts, or len(bytes) if there is none.
+func (m *RxMetadata) decodeRxMetadata(bytes []byte, attached bool) int {
+	m.ReceivedAt = time.Now()
+	end := len(bytes) - rxMetadataSize
+	if !attached || end < 1 {
+		return len(bytes)
+	}
+	m.Attached = true
+	m.ChannelIdx = bytes[end]
+	m.DataRateIdx = bytes[end+1]
+	m.RSSI = int8(bytes[end+2])
+	m.SNR = int8(bytes[end+3])
+	m.RxSlot = bytes[end+4]
+	return end
+}
+
+// TxMetadata holds the Tx channel info the modem attaches to transmit
+// indications when the extended HCI output format is enabled.
+type TxMetadata struct {
+	Attached         bool
+	ChannelIdx       byte
+	DataRateIdx      byte
+	NumTxPackets     byte
+	TRXPowerLevel    byte
+	RFMessageAirtime uint32
+}
+
+func (m *TxMetadata) TxInfo() *TxMetadata {
+	return m
+}
+
+func (m *TxMetadata) decodeTxMetadata(bytes []byte, attached bool) {
+	if !attached || len(bytes) < 1+txMetadataSize {
+		return
+	}
+	m.Attached = true
+	m.ChannelIdx = bytes[1]
+	m.DataRateIdx = bytes[2]
+	m.NumTxPackets = bytes[3]
+	m.TRXPowerLevel = bytes[4]
+	m.RFMessageAirtime = binary.LittleEndian.Uint32(bytes[5:9])
+}
+
+type RxIndication interface {
+	WiModMessageInd
+	RxInfo() *RxMetadata
+}
+
+type TxIndication interface {
+	WiModMessageInd
+	TxInfo() *TxMetadata
+}